@@ -0,0 +1,163 @@
+// This is free and unencumbered software released into the public domain.
+
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+
+// For more information, please refer to <http://unlicense.org>
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	agent "github.com/nomasters/hashmap/pkg/sig/agent"
+	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// agentSocketEnv is the environment variable holding the socket of a signing agent
+const agentSocketEnv = "HASHMAP_AGENT_SOCK"
+
+var agentKeysetPath string
+var agentListenPath string
+var agentSocket string
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "runs a signing agent for a keyset on a Unix socket",
+	Long: `runs a signing agent that holds a keyset and signs for other hashmap commands
+over a Unix socket, so that the keyset, and its passphrase, are only loaded by the
+agent. The agent holds the keyset lock until it exits, and persists the state of
+stateful signers such as XMSS after every signature.
+
+The agent prints the socket in a form that can be evaluated by a shell:
+
+	eval $(hashmap agent -k hashmap.keyset &)
+
+generate payload and put then sign with the agent at --agent, or at ` + agentSocketEnv + `
+when --keyset is not set. The socket defaults to hashmap-agent.sock in
+$XDG_RUNTIME_DIR, or to agent.sock in a hashmap-agent-<uid> directory in the
+temporary directory. It is only accessible by the user running the agent, and its
+directory must be owned by that user and not be accessible by others.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runAgent(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// runAgent serves the keyset signers on the agent socket until an interrupt or
+// terminate signal is received
+func runAgent() error {
+	keyset, err := sigutil.OpenKeySetFile(agentKeysetPath, sigutil.WithPassphrase(keysetPassphrase))
+	if err != nil {
+		return err
+	}
+	defer keyset.Close()
+	a, err := agent.New(keyset.Signers())
+	if err != nil {
+		return err
+	}
+	path := agentListenPath
+	if path == "" {
+		if path, err = defaultAgentSocket(); err != nil {
+			return err
+		}
+	}
+	l, err := agent.Listen(path)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	fmt.Printf("%v=%v; export %v;\n", agentSocketEnv, path, agentSocketEnv)
+	return a.Serve(l)
+}
+
+// defaultAgentSocket returns hashmap-agent.sock in $XDG_RUNTIME_DIR, or if it is
+// unset, agent.sock in a hashmap-agent-<uid> directory in the temporary directory,
+// which is created with 0700 permissions. agent.Listen refuses the directory if it
+// was created by another user.
+func defaultAgentSocket() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "hashmap-agent.sock"), nil
+	}
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("hashmap-agent-%d", os.Getuid()))
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	return filepath.Join(dir, "agent.sock"), nil
+}
+
+// addAgentFlags adds the --agent flag to commands that sign payloads
+func addAgentFlags(f *pflag.FlagSet) {
+	f.StringVar(&agentSocket, "agent", "", "sign with the keys of the signing agent at this socket instead of a keyset. Defaults to "+agentSocketEnv+" when --keyset is not set")
+}
+
+// openSigners returns the signers of the signing agent set by --agent, or by
+// HASHMAP_AGENT_SOCK when --keyset is not set, and otherwise the signers of the
+// keyset at keysetPath. The returned func closes the agent connection or keyset.
+func openSigners(cmd *cobra.Command, keysetPath string) ([]sig.Signer, func() error, error) {
+	path := agentSocket
+	if path == "" && !cmd.Flags().Changed("keyset") {
+		path = os.Getenv(agentSocketEnv)
+	}
+	if path == "" {
+		keyset, err := sigutil.OpenKeySetFile(keysetPath, sigutil.WithPassphrase(keysetPassphrase))
+		if err != nil {
+			return nil, nil, err
+		}
+		return keyset.Signers(), keyset.Close, nil
+	}
+	ctx := context.Background()
+	c, err := agent.Dial(ctx, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("signing agent: %w", err)
+	}
+	signers, err := c.Signers(ctx)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return signers, c.Close, nil
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().StringVarP(&agentKeysetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file. Defaults `./hashmap.keyset`")
+	agentCmd.Flags().StringVarP(&agentListenPath, "socket", "s", "", "the path of the Unix socket to listen on, in a directory only accessible by the current user. Defaults to hashmap-agent.sock in $XDG_RUNTIME_DIR or agent.sock in hashmap-agent-<uid> in the temporary directory")
+	addPassphraseFlags(agentCmd.Flags())
+}
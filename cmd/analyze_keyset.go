@@ -5,7 +5,7 @@ Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
 You may obtain a copy of the License at
 
-    http://www.apache.org/licenses/LICENSE-2.0
+	http://www.apache.org/licenses/LICENSE-2.0
 
 Unless required by applicable law or agreed to in writing, software
 distributed under the License is distributed on an "AS IS" BASIS,
@@ -16,49 +16,47 @@ limitations under the License.
 package cmd
 
 import (
-	// "io/ioutil"
-	// "log"
-
-	// analyze "github.com/nomasters/hashmap/internal/analyze"
-	// sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
 
+	analyze "github.com/nomasters/hashmap/internal/analyze"
+	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
 	"github.com/spf13/cobra"
 )
 
+var analyzeKeysetPath string
+
 // analyzeKeysetCmd represents the analyzeKeyset command
 var analyzeKeysetCmd = &cobra.Command{
 	Use:   "keyset",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "analyzes a keyset without signing",
+	Long: `analyzes a keyset and outputs JSON with the endpoint hash, the algorithm of
+each signer, whether it is post-quantum resistant and, for stateful signers such
+as XMSS, how many signatures remain. Analysis never signs, so it does not consume
+XMSS one-time keys. Encrypted keysets are decrypted with the passphrase from
+--passphrase-fd, HASHMAP_KEYSET_PASSPHRASE or a terminal prompt.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// TODO: handle custom file paths
-		// signerBytes, err := ioutil.ReadFile("hashmap.keyset")
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
-		// signers, err := sigutil.Decode(signerBytes)
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
-		// fmt.Printf("%s\n", analyze.Signers(signers))
+		b, err := ioutil.ReadFile(analyzeKeysetPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		k, err := analyze.NewKeySet(b, sigutil.WithPassphrase(keysetPassphrase))
+		if err != nil {
+			log.Fatal(err)
+		}
+		output, err := json.Marshal(k)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", output)
 	},
 }
 
 func init() {
 	analyzeCmd.AddCommand(analyzeKeysetCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// analyzeKeysetCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// analyzeKeysetCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	analyzeKeysetCmd.Flags().StringVarP(&analyzeKeysetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file. Defaults `./hashmap.keyset`")
+	addPassphraseFlags(analyzeKeysetCmd.Flags())
 }
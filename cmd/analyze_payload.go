@@ -27,6 +27,8 @@ import (
 	analyze "github.com/nomasters/hashmap/internal/analyze"
 )
 
+var analyzePreviousPath string
+
 // analyzePayloadCmd represents the analyzePayload command
 var analyzePayloadCmd = &cobra.Command{
 	Use:   "payload",
@@ -42,7 +44,15 @@ to quickly create a Cobra application.`,
 		if err != nil {
 			log.Fatalln(err)
 		}
-		p , err := analyze.NewPayload(b)
+		var opts []analyze.PayloadOption
+		if analyzePreviousPath != "" {
+			prev, err := ioutil.ReadFile(analyzePreviousPath)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			opts = append(opts, analyze.WithPrevious(prev))
+		}
+		p , err := analyze.NewPayload(b, opts...)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -58,6 +68,8 @@ to quickly create a Cobra application.`,
 func init() {
 	analyzeCmd.AddCommand(analyzePayloadCmd)
 
+	analyzePayloadCmd.Flags().StringVarP(&analyzePreviousPath, "previous", "p", "", "the payload file the analyzed payload replaces, to check the continuity of a chain")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -0,0 +1,117 @@
+// This is free and unencumbered software released into the public domain.
+
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+
+// For more information, please refer to <http://unlicense.org>
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	analyze "github.com/nomasters/hashmap/internal/analyze"
+	client "github.com/nomasters/hashmap/pkg/client"
+	payload "github.com/nomasters/hashmap/pkg/payload"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// output modes shared by the put and get commands
+const (
+	outputRaw     = "raw"
+	outputJSON    = "json"
+	outputAnalyze = "analyze"
+)
+
+// addClientFlags adds the flags shared by commands that talk to a hashmap server
+func addClientFlags(f *pflag.FlagSet, output *string) {
+	f.String("url", "", "the hashmap server url. Defaults to a url built from the server config")
+	f.StringVarP(output, "output", "o", outputRaw, "output mode: raw, json or analyze")
+}
+
+// newClient returns a client for the server url. The url is taken from the --url flag
+// or client.url config key, otherwise it is built from the server.tls, server.host,
+// server.port and server.baseRoute config used by `hashmap run`.
+func newClient(f *pflag.FlagSet) (*client.Client, error) {
+	u, _ := f.GetString("url")
+	if u == "" {
+		u = viper.GetString("client.url")
+	}
+	if u != "" {
+		return client.New(u)
+	}
+	scheme := "http"
+	if viper.GetBool("server.tls") {
+		scheme = "https"
+	}
+	host := viper.GetString("server.host")
+	if host == "" || host == "0.0.0.0" {
+		host = "localhost"
+	}
+	port := viper.GetInt("server.port")
+	if port == 0 {
+		port = 3000
+	}
+	return client.New(
+		fmt.Sprintf("%v://%v:%v", scheme, host, port),
+		client.WithBaseRoute(viper.GetString("server.baseRoute")),
+	)
+}
+
+// validateOutput returns an error if mode is not one of the output modes
+func validateOutput(mode string) error {
+	switch mode {
+	case outputRaw, outputJSON, outputAnalyze:
+		return nil
+	}
+	return fmt.Errorf("invalid output mode: %q, must be raw, json or analyze", mode)
+}
+
+// printPayload writes a payload to stdout in the requested output mode. raw writes
+// the data bytes as-is, json writes the payload JSON and analyze writes the output
+// of the analyze payload command.
+func printPayload(p payload.Payload, mode string) error {
+	if err := validateOutput(mode); err != nil {
+		return err
+	}
+	if mode == outputRaw {
+		_, err := os.Stdout.Write(p.Data)
+		return err
+	}
+	b, err := payload.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if mode == outputAnalyze {
+		a, err := analyze.NewPayload(b)
+		if err != nil {
+			return err
+		}
+		if b, err = json.Marshal(a); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%s\n", b)
+	return nil
+}
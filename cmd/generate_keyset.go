@@ -26,10 +26,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"time"
 
+	payload "github.com/nomasters/hashmap/pkg/payload"
+	sig "github.com/nomasters/hashmap/pkg/sig"
 	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
 	"github.com/spf13/cobra"
 )
@@ -38,41 +41,150 @@ import (
 var keySetCmd = &cobra.Command{
 	Use:   "keyset",
 	Short: "generates a key-set to be used for signing payloads",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Long: `generates a keyset, writes it to --output and prints its endpoint hash.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// TODO:
-		// - Update description
-		// - add flags in for custom outputfile name
-		// - add flags for custom key-set types
+The keys are chosen with --types, a comma separated list of key types such as
+ed25519, ecdsa_p256, secp256k1, ml_dsa_65 or xmss_sha2_10_256, or with --preset.
+Keys are kept in the order given, and --xmss keys are appended last. Payloads are
+signed in keyset order and the endpoint is the blake2b-512 hash of the public keys
+concatenated in that order, so the same keys in a different order publish to a
+different endpoint.
+
+XMSS keys use the single tree parameter sets sha2_10_256 and sha2_16_256. Multi
+tree XMSS^MT parameter sets are not supported.
+
+An existing keyset is never overwritten unless --force is set. Overwriting a
+keyset discards its private keys, and with them control of its endpoint.
 
-		signers := sigutil.NewDefaultSigners()
-		b, err := sigutil.Encode(signers)
+For example:
+
+	hashmap generate keyset --types=ed25519,xmss_sha2_10_256 --output=/path/hashmap.keyset`,
+	Run: func(cmd *cobra.Command, args []string) {
+		signers, err := keySetSigners(cmd)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		if err := ioutil.WriteFile("hashmap.keyset", b, 0600); err != nil {
+		endpoint, err := sigutil.SignersEndpoint(signers)
+		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+		b, err := encodeKeySet(signers, keySetEncrypt)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := writeOutputFile(keySetOutput, b, keySetForce); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(endpoint)
 	},
 }
 
-func init() {
-	generateCmd.AddCommand(keySetCmd)
+var keySetPreset string
+var keySetTypes []string
+var keySetXMSS string
+var keySetOutput string
+var keySetForce bool
+var keySetEncrypt bool
+
+// keySetSigners generates the signers selected by the --types or --preset flags,
+// followed by the --xmss key
+func keySetSigners(cmd *cobra.Command) ([]sig.Signer, error) {
+	n := len(keySetTypes)
+	if keySetXMSS != "" {
+		n++
+	}
+	if n > payload.MaxSigBundleCount {
+		return nil, fmt.Errorf("keyset has %d keys, payloads allow at most %d signatures", n, payload.MaxSigBundleCount)
+	}
+	var signers []sig.Signer
+	if len(keySetTypes) > 0 {
+		if cmd.Flags().Changed("preset") {
+			return nil, errors.New("--types and --preset can not be used together")
+		}
+		s, err := sigutil.GenerateSigners(keySetTypes)
+		if err != nil {
+			return nil, err
+		}
+		signers = s
+	} else {
+		preset, ok := sigutil.Presets[keySetPreset]
+		if !ok {
+			return nil, fmt.Errorf("invalid preset: %q, must be default, experimental or hybrid", keySetPreset)
+		}
+		signers = preset()
+	}
+	if keySetXMSS != "" {
+		s, err := genXMSS(keySetXMSS)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, s)
+	}
+	return signers, nil
+}
 
-	// Here you will define your flags and configuration settings.
+// writeOutputFile writes a generated file, such as a keyset, to path. It refuses to
+// replace an existing file unless force is set, and never replaces a locked keyset.
+func writeOutputFile(path string, b []byte, force bool) error {
+	if !force {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			return fmt.Errorf("%v already exists, use --force to overwrite it", path)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(b); err != nil {
+			f.Close()
+			os.Remove(path)
+			return err
+		}
+		return f.Close()
+	}
+	if _, err := os.Stat(path + ".lock"); err == nil {
+		return fmt.Errorf("%v: %v.lock", sigutil.ErrKeySetLocked, path)
+	}
+	return sigutil.WriteFileAtomic(path, b, 0600)
+}
+
+// encodeKeySet returns the JSON keyset for signers, encrypted with a new passphrase
+// if encrypt is true
+func encodeKeySet(signers []sig.Signer, encrypt bool) ([]byte, error) {
+	if !encrypt {
+		return sigutil.Encode(signers)
+	}
+	passphrase, err := newKeysetPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	ks, err := sigutil.NewKeySet(signers, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return sigutil.EncryptKeySet(ks, passphrase)
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// keySetCmd.PersistentFlags().String("foo", "", "A help for foo")
+// genXMSS returns a new XMSS signer for a parameter set name, such as sha2_16_256
+func genXMSS(params string) (sig.Signer, error) {
+	a, err := sig.LookupName("xmss_" + params)
+	if err != nil || a.Gen == nil {
+		return nil, fmt.Errorf("invalid xmss parameter set: %q, must be sha2_10_256 or sha2_16_256", params)
+	}
+	return a.Gen(), nil
+}
+
+func init() {
+	generateCmd.AddCommand(keySetCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// keySetCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	keySetCmd.Flags().StringSliceVarP(&keySetTypes, "types", "t", nil, "comma separated key types, in signing order: ed25519, ecdsa_p256, secp256k1, ml_dsa_65, xmss_sha2_10_256 or xmss_sha2_16_256. Overrides the preset")
+	keySetCmd.Flags().StringVar(&keySetPreset, "preset", "default", "the keyset preset: default (ed25519), experimental (ed25519 and xmss) or hybrid (ed25519 and the stateless post-quantum ml_dsa_65)")
+	keySetCmd.Flags().StringVar(&keySetXMSS, "xmss", "", "adds an XMSS key with the parameter set sha2_10_256 or sha2_16_256. Larger trees allow more signatures but are slower to generate and sign with")
+	keySetCmd.Flags().StringVarP(&keySetOutput, "output", "o", "hashmap.keyset", "the path the keyset file is written to")
+	keySetCmd.Flags().BoolVarP(&keySetForce, "force", "f", false, "overwrites an existing keyset file")
+	keySetCmd.Flags().BoolVar(&keySetEncrypt, "encrypt", false, "encrypts the keyset with a passphrase from --passphrase-fd, "+keysetPassphraseEnv+" or a terminal prompt")
+	addPassphraseFlags(keySetCmd.Flags())
 }
@@ -16,12 +16,13 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"time"
 
 	payload "github.com/nomasters/hashmap/pkg/payload"
-	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
+	sig "github.com/nomasters/hashmap/pkg/sig"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +31,12 @@ var ttl string
 var timestamp int64
 var keysetPath string
 var outputPath string
+var outputFormat string
+var policyPath string
+var cosignPath string
+var payloadVersion int
+var sequence uint64
+var previousPath string
 
 // generatePayloadCmd represents the generatePayload command
 var generatePayloadCmd = &cobra.Command{
@@ -42,41 +49,130 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-
-		signerBytes, err := ioutil.ReadFile(keysetPath)
-		if err != nil {
-			// TODO write a more meaningful error message
-			log.Fatal(err)
-		}
-		signers, err := sigutil.Decode(signerBytes)
-		if err != nil {
-			// TODO write a more meaningful error message
+		if err := generatePayload(cmd); err != nil {
 			log.Fatal(err)
 		}
+	},
+}
 
-		t, err := time.ParseDuration(ttl)
-		if err != nil {
-			// TODO write a more meaningful error message
-			log.Fatal(err)
-		}
+// generatePayload signs a payload with the keyset, or a signing agent, and writes it
+// to outputPath. The keyset is held open for the duration so that stateful signer
+// state is persisted before the signed payload is written.
+func generatePayload(cmd *cobra.Command) error {
+	signers, closeSigners, err := openSigners(cmd, keysetPath)
+	if err != nil {
+		// TODO write a more meaningful error message
+		return err
+	}
+	defer closeSigners()
 
-		p, err := payload.Generate(
-			[]byte(message),
-			signers,
-			payload.WithTTL(t),
-			payload.WithTimestamp(time.Unix(0, timestamp)),
-		)
+	f, err := parseFormat(outputFormat)
+	if err != nil {
+		return err
+	}
+	if cosignPath != "" {
+		return cosignPayload(signers, f)
+	}
+
+	t, err := time.ParseDuration(ttl)
+	if err != nil {
+		// TODO write a more meaningful error message
+		return err
+	}
+
+	v, err := parseVersion(payloadVersion)
+	if err != nil {
+		return err
+	}
+	opts := []payload.Option{
+		payload.WithVersion(v),
+		payload.WithTTL(t),
+		payload.WithTimestamp(time.Unix(0, timestamp)),
+	}
+	if sequence != 0 {
+		opts = append(opts, payload.WithSequence(sequence))
+	}
+	if previousPath != "" {
+		prev, err := readPayload(previousPath)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		b, err := payload.Marshal(p)
+		opts = append(opts, payload.WithPrevious(prev))
+	}
+	if policyPath != "" {
+		policy, err := readPolicy(policyPath)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		if err := ioutil.WriteFile(outputPath, b, 0600); err != nil {
-			log.Fatal(err)
+		if signers, err = policySigners(signers, policy); err != nil {
+			return err
 		}
-	},
+		opts = append(opts, payload.WithPolicy(policy))
+	}
+
+	p, err := payload.Generate([]byte(message), signers, opts...)
+	if err != nil {
+		return err
+	}
+	b, err := payload.MarshalFormat(p, f)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputPath, b, 0600)
+}
+
+// cosignPayload adds the signatures of the signers in the policy of the threshold
+// payload at cosignPath and writes it to outputPath
+func cosignPayload(signers []sig.Signer, f payload.Format) error {
+	p, err := readPayload(cosignPath)
+	if err != nil {
+		return err
+	}
+	if p.Policy == nil {
+		return fmt.Errorf("%v is not a threshold payload", cosignPath)
+	}
+	signers, err = policySigners(signers, p.Policy)
+	if err != nil {
+		return err
+	}
+	if err := p.Cosign(signers); err != nil {
+		return err
+	}
+	b, err := payload.MarshalFormat(p, f)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputPath, b, 0600)
+}
+
+// readPayload reads a JSON or protobuf encoded payload file
+func readPayload(path string) (payload.Payload, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return payload.Payload{}, err
+	}
+	return payload.UnmarshalFormat(b, payload.DetectFormat(b))
+}
+
+// parseFormat takes a format flag value, json or protobuf, and returns a payload.Format
+func parseFormat(s string) (payload.Format, error) {
+	switch s {
+	case "json":
+		return payload.FormatJSON, nil
+	case "protobuf":
+		return payload.FormatProtobuf, nil
+	}
+	return 0, fmt.Errorf("invalid format: %q, must be json or protobuf", s)
+}
+
+// parseVersion takes a payload version flag value, 1 or 3, and returns a payload.Version.
+// Version 2 is set by WithPolicy for threshold payloads.
+func parseVersion(n int) (payload.Version, error) {
+	switch v := payload.Version(n); v {
+	case payload.V1, payload.V3:
+		return v, nil
+	}
+	return 0, fmt.Errorf("invalid payload version: %d, must be 1 or 3", n)
 }
 
 func init() {
@@ -87,4 +183,13 @@ func init() {
 	generatePayloadCmd.Flags().Int64VarP(&timestamp, "timestamp", "s", time.Now().UnixNano(), "timestamp for message in unix-nano time. Defaults now")
 	generatePayloadCmd.Flags().StringVarP(&keysetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file. Defaults `./hashamp.keyset`")
 	generatePayloadCmd.Flags().StringVarP(&outputPath, "output", "o", "payload.protobuf", "the path for the output payload file. Defaults `./payload.protobuf`")
+	generatePayloadCmd.Flags().StringVarP(&outputFormat, "format", "f", "protobuf", "the output payload encoding: json or protobuf. Defaults `protobuf`")
+	generatePayloadCmd.Flags().StringVar(&policyPath, "policy", "", "signs a threshold payload for the policy file written by generate policy, with the keyset keys in the policy")
+	generatePayloadCmd.Flags().StringVar(&cosignPath, "cosign", "", "adds signatures by the keyset keys to the threshold payload file, ignoring the message, ttl and timestamp")
+	generatePayloadCmd.Flags().IntVar(&payloadVersion, "payload-version", int(payload.V1), "the payload version: 1, or 3 for domain separated signatures. Threshold payloads are version 2 unless 3 is set")
+	generatePayloadCmd.Flags().Uint64Var(&sequence, "sequence", 0, "starts a chain of version 3 payloads at the sequence number")
+	generatePayloadCmd.Flags().StringVar(&previousPath, "previous", "", "chains a version 3 payload to the payload file it replaces, with the next sequence number")
+	generatePayloadCmd.MarkFlagsMutuallyExclusive("sequence", "previous")
+	addPassphraseFlags(generatePayloadCmd.Flags())
+	addAgentFlags(generatePayloadCmd.Flags())
 }
@@ -0,0 +1,175 @@
+// This is free and unencumbered software released into the public domain.
+
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+
+// For more information, please refer to <http://unlicense.org>
+
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	payload "github.com/nomasters/hashmap/pkg/payload"
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
+	"github.com/spf13/cobra"
+)
+
+// generatePolicyCmd represents the generate policy command
+var generatePolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "generates a k-of-n threshold policy for multi-signature payloads",
+	Long: `generates a threshold policy, writes it to --output and prints its endpoint.
+
+A threshold payload is published to the endpoint of its policy, which is the
+hash of the threshold and the ordered list of public keys. It is valid when
+signed by at least --threshold of the keys, so any k of n operators can publish.
+
+Keys are read from the public keys of --keyset files, then from --key values of
+the form <type>:<base64 public key>, such as ed25519:nVDMT7d/eM...= as printed by
+hashmap analyze keyset. Changing the order of the keys changes the endpoint.
+
+Operators sign with generate payload --policy, then pass the payload on to be
+signed by the others with generate payload --cosign.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		policy, err := newPolicy()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		b, err := json.MarshalIndent(policy, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := writeOutputFile(policyOutput, append(b, '\n'), policyForce); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(policy.Endpoint())
+	},
+}
+
+var policyThreshold int
+var policyKeysets []string
+var policyKeys []string
+var policyOutput string
+var policyForce bool
+
+// newPolicy returns the policy for the --threshold, --keyset and --key flags
+func newPolicy() (*payload.Policy, error) {
+	var keys []payload.PolicyKey
+	for _, path := range policyKeysets {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		signers, err := sigutil.Decode(b, sigutil.WithPassphrase(keysetPassphrase))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		k, err := payload.SignerKeys(signers)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+	}
+	for _, v := range policyKeys {
+		k, err := parsePolicyKey(v)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return payload.NewPolicy(policyThreshold, keys)
+}
+
+// parsePolicyKey parses a <type>:<base64 public key> flag value
+func parsePolicyKey(v string) (payload.PolicyKey, error) {
+	t, pub, ok := strings.Cut(v, ":")
+	if !ok {
+		return payload.PolicyKey{}, fmt.Errorf("invalid key: %q, must be <type>:<base64 public key>", v)
+	}
+	a, err := sigutil.LookupType(t)
+	if err != nil {
+		return payload.PolicyKey{}, err
+	}
+	b, err := base64.StdEncoding.DecodeString(pub)
+	if err != nil {
+		return payload.PolicyKey{}, fmt.Errorf("invalid key: %q: %v", v, err)
+	}
+	return payload.PolicyKey{Alg: a.Alg, Pub: b}, nil
+}
+
+// readPolicy reads and validates a JSON policy file
+func readPolicy(path string) (*payload.Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p payload.Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return &p, nil
+}
+
+// policySigners returns the signers whose keys are in the policy. It returns an error
+// if none are.
+func policySigners(signers []sig.Signer, policy *payload.Policy) ([]sig.Signer, error) {
+	keys, err := payload.SignerKeys(signers)
+	if err != nil {
+		return nil, err
+	}
+	var o []sig.Signer
+	for i, k := range keys {
+		for _, pk := range policy.Keys {
+			if k.Alg == pk.Alg && string(k.Pub) == string(pk.Pub) {
+				o = append(o, signers[i])
+				break
+			}
+		}
+	}
+	if len(o) == 0 {
+		return nil, fmt.Errorf("the keyset has no keys in the policy for %v", policy.Endpoint())
+	}
+	return o, nil
+}
+
+func init() {
+	generateCmd.AddCommand(generatePolicyCmd)
+
+	generatePolicyCmd.Flags().IntVarP(&policyThreshold, "threshold", "n", 1, "the number of keys that must sign a payload")
+	generatePolicyCmd.Flags().StringSliceVarP(&policyKeysets, "keyset", "k", nil, "adds the public keys of keyset files, in order")
+	generatePolicyCmd.Flags().StringArrayVar(&policyKeys, "key", nil, "adds a public key as <type>:<base64 public key>, may be repeated")
+	generatePolicyCmd.Flags().StringVarP(&policyOutput, "output", "o", "hashmap.policy", "the path the policy file is written to")
+	generatePolicyCmd.Flags().BoolVarP(&policyForce, "force", "f", false, "overwrites an existing policy file")
+	addPassphraseFlags(generatePolicyCmd.Flags())
+}
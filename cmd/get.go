@@ -0,0 +1,98 @@
+// This is free and unencumbered software released into the public domain.
+
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+
+// For more information, please refer to <http://unlicense.org>
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	client "github.com/nomasters/hashmap/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var getOutput string
+var getHistory bool
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get <endpoint>",
+	Short: "fetches and verifies a payload from a hashmap server",
+	Long: `fetches the payload for an endpoint from a hashmap server, verifies its
+signatures and that its public keys hash to the endpoint, and prints it.
+
+The raw output mode prints the payload data, json prints the payload and analyze
+prints an analysis of the payload. With --history, the payloads retained by the
+server for the endpoint are printed newest first, one per line.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutput(getOutput); err != nil {
+			log.Fatal(err)
+		}
+		c, err := newClient(cmd.Flags())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if getHistory {
+			if err := printHistory(c, args[0]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		p, err := c.GetVerified(context.Background(), args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := printPayload(p, getOutput); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// printHistory fetches and verifies the payloads retained for an endpoint and prints
+// them newest first, one per line
+func printHistory(c *client.Client, endpoint string) error {
+	history, err := c.History(context.Background(), endpoint)
+	if err != nil {
+		return err
+	}
+	for _, p := range history {
+		if err := printPayload(p, getOutput); err != nil {
+			return err
+		}
+		if getOutput == outputRaw {
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+
+	getCmd.Flags().BoolVar(&getHistory, "history", false, "prints the payloads retained by the server for the endpoint, newest first")
+	addClientFlags(getCmd.Flags(), &getOutput)
+}
@@ -0,0 +1,280 @@
+// This is free and unencumbered software released into the public domain.
+
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+
+// For more information, please refer to <http://unlicense.org>
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	payload "github.com/nomasters/hashmap/pkg/payload"
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// manageKeySetCmd represents the keyset command
+var manageKeySetCmd = &cobra.Command{
+	Use:   "keyset",
+	Short: "manages keyset files",
+}
+
+// migrateKeySetCmd represents the keyset migrate command
+var migrateKeySetCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "rewrites a legacy gob keyset in the versioned JSON format",
+	Long: `rewrites a keyset written by earlier versions of hashmap, which used Go's gob
+encoding, in the versioned JSON keyset format. Legacy keysets are also read
+transparently and rewritten the next time a stateful key, such as XMSS, signs.
+Migrated keys have no creation time. The public keys and their order are
+unchanged, so the endpoint hash stays the same.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		k, err := sigutil.OpenKeySetFile(migrateKeySetPath, sigutil.WithPassphrase(keysetPassphrase))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer k.Close()
+		if !k.Legacy() {
+			fmt.Printf("%v is already in keyset format version %d\n", migrateKeySetPath, sigutil.KeySetVersion)
+			return
+		}
+		if err := k.Save(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("migrated %v to keyset format version %d\n", migrateKeySetPath, sigutil.KeySetVersion)
+	},
+}
+
+// encryptKeySetCmd represents the keyset encrypt command
+var encryptKeySetCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "encrypts a keyset with a passphrase",
+	Long: `encrypts a keyset with a passphrase from --passphrase-fd, the
+HASHMAP_KEYSET_PASSPHRASE environment variable or a terminal prompt. The key is
+derived from the passphrase with argon2id and the keyset is encrypted with
+XChaCha20-Poly1305. Commands that read the keyset decrypt it transparently with
+the passphrase from the same sources, and signing keeps it encrypted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		k, err := sigutil.OpenKeySetFile(encryptKeySetPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer k.Close()
+		if k.Encrypted() {
+			fmt.Printf("%v is already encrypted\n", encryptKeySetPath)
+			os.Exit(1)
+		}
+		passphrase, err := newKeysetPassphrase()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := k.SetPassphrase(passphrase); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// decryptKeySetCmd represents the keyset decrypt command
+var decryptKeySetCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "removes the passphrase encryption from a keyset",
+	Run: func(cmd *cobra.Command, args []string) {
+		k, err := sigutil.OpenKeySetFile(decryptKeySetPath, sigutil.WithPassphrase(keysetPassphrase))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer k.Close()
+		if !k.Encrypted() {
+			fmt.Printf("%v is not encrypted\n", decryptKeySetPath)
+			os.Exit(1)
+		}
+		if err := k.SetPassphrase(nil); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// importKeySetCmd represents the keyset import command
+var importKeySetCmd = &cobra.Command{
+	Use:   "import <private key file>...",
+	Short: "imports ed25519 private keys into a keyset",
+	Long: `imports existing ed25519 private keys into a keyset, creating it if it does not
+exist. Keys can be OpenSSH private keys, as written by ssh-keygen -t ed25519,
+PKCS #8 PEM private keys, as written by openssl genpkey -algorithm ed25519, or
+32 byte seeds as raw bytes, hex or base64. Passphrase protected OpenSSH keys
+prompt for their passphrase on the terminal.
+
+Imported keys are appended to the keyset in the order given. Adding keys changes
+the endpoint of the keyset, so the new endpoint is printed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		endpoint, err := importKeys(importKeySetPath, args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(endpoint)
+	},
+}
+
+// importKeys parses the private key files and adds them to the keyset at path,
+// creating it if it does not exist. It returns the endpoint of the keyset.
+func importKeys(path string, files []string) (string, error) {
+	var signers []sig.Signer
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		s, err := sigutil.ParsePrivateKey(b, sigutil.WithPassphrase(privateKeyPassphrase(file)))
+		if err != nil {
+			return "", fmt.Errorf("%v: %w", file, err)
+		}
+		signers = append(signers, s)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if len(signers) > payload.MaxSigBundleCount {
+			return "", fmt.Errorf("keyset would have %d keys, payloads allow at most %d signatures", len(signers), payload.MaxSigBundleCount)
+		}
+		b, err := encodeKeySet(signers, importKeySetEncrypt)
+		if err != nil {
+			return "", err
+		}
+		if err := writeOutputFile(path, b, false); err != nil {
+			return "", err
+		}
+		return sigutil.SignersEndpoint(signers)
+	}
+
+	k, err := sigutil.OpenKeySetFile(path, sigutil.WithPassphrase(keysetPassphrase))
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+	if n := len(k.Signers()) + len(signers); n > payload.MaxSigBundleCount {
+		return "", fmt.Errorf("keyset would have %d keys, payloads allow at most %d signatures", n, payload.MaxSigBundleCount)
+	}
+	if err := k.Add(signers...); err != nil {
+		return "", err
+	}
+	return k.Endpoint()
+}
+
+// privateKeyPassphrase returns a func that prompts on the terminal for the passphrase
+// of a private key file. It is kept separate from the keyset passphrase sources.
+func privateKeyPassphrase(file string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return nil, errors.New("passphrase protected private keys can only be imported from a terminal")
+		}
+		return promptPassphrase(fd, fmt.Sprintf("passphrase for %v: ", file))
+	}
+}
+
+// exportKeySetCmd represents the keyset export command
+var exportKeySetCmd = &cobra.Command{
+	Use:   "export",
+	Short: "exports an ed25519 private key from a keyset",
+	Long: `exports the ed25519 private key at --index in a keyset to --output as an
+unencrypted OpenSSH private key, a PKCS #8 PEM private key or a raw 32 byte seed.
+Keys are indexed from 0 in keyset order, as shown by hashmap analyze keyset.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := exportKey(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// exportKey writes the private key at exportKeyIndex to exportKeyOutput
+func exportKey() error {
+	f, err := sigutil.ParseKeyFormat(exportKeyFormat)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(exportKeySetPath)
+	if err != nil {
+		return err
+	}
+	signers, err := sigutil.Decode(b, sigutil.WithPassphrase(keysetPassphrase))
+	if err != nil {
+		return err
+	}
+	if exportKeyIndex < 0 || exportKeyIndex >= len(signers) {
+		return fmt.Errorf("invalid index %d, the keyset has %d keys", exportKeyIndex, len(signers))
+	}
+	key, err := sigutil.MarshalPrivateKey(signers[exportKeyIndex], f)
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(exportKeyOutput, key, false)
+}
+
+var importKeySetPath string
+var importKeySetEncrypt bool
+var exportKeySetPath string
+var exportKeyIndex int
+var exportKeyFormat string
+var exportKeyOutput string
+var migrateKeySetPath string
+var encryptKeySetPath string
+var decryptKeySetPath string
+
+func init() {
+	rootCmd.AddCommand(manageKeySetCmd)
+	manageKeySetCmd.AddCommand(migrateKeySetCmd)
+	manageKeySetCmd.AddCommand(encryptKeySetCmd)
+	manageKeySetCmd.AddCommand(decryptKeySetCmd)
+	manageKeySetCmd.AddCommand(importKeySetCmd)
+	manageKeySetCmd.AddCommand(exportKeySetCmd)
+
+	migrateKeySetCmd.Flags().StringVarP(&migrateKeySetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file")
+	addPassphraseFlags(migrateKeySetCmd.Flags())
+	encryptKeySetCmd.Flags().StringVarP(&encryptKeySetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file")
+	addPassphraseFlags(encryptKeySetCmd.Flags())
+	decryptKeySetCmd.Flags().StringVarP(&decryptKeySetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file")
+	addPassphraseFlags(decryptKeySetCmd.Flags())
+	importKeySetCmd.Flags().StringVarP(&importKeySetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file")
+	importKeySetCmd.Flags().BoolVar(&importKeySetEncrypt, "encrypt", false, "encrypts the keyset with a passphrase when creating it")
+	addPassphraseFlags(importKeySetCmd.Flags())
+	exportKeySetCmd.Flags().StringVarP(&exportKeySetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file")
+	exportKeySetCmd.Flags().IntVarP(&exportKeyIndex, "index", "i", 0, "the index of the key in the keyset")
+	exportKeySetCmd.Flags().StringVarP(&exportKeyFormat, "format", "f", "openssh", "the private key format: openssh, pkcs8 or seed")
+	exportKeySetCmd.Flags().StringVarP(&exportKeyOutput, "output", "o", "", "the path the private key is written to, it must not exist")
+	exportKeySetCmd.MarkFlagRequired("output")
+	addPassphraseFlags(exportKeySetCmd.Flags())
+}
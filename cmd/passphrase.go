@@ -0,0 +1,110 @@
+// This is free and unencumbered software released into the public domain.
+
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+
+// For more information, please refer to <http://unlicense.org>
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+// keysetPassphraseEnv is the environment variable a keyset passphrase is read from
+const keysetPassphraseEnv = "HASHMAP_KEYSET_PASSPHRASE"
+
+var passphraseFD int
+
+// addPassphraseFlags adds the --passphrase-fd flag to commands that read keysets
+func addPassphraseFlags(f *pflag.FlagSet) {
+	f.IntVar(&passphraseFD, "passphrase-fd", -1, "read the keyset passphrase from the first line of this file descriptor instead of "+keysetPassphraseEnv+" or a terminal prompt")
+}
+
+// keysetPassphrase returns the passphrase of an encrypted keyset. It is passed to
+// sigutil.WithPassphrase, so it is only called for keysets that are encrypted.
+func keysetPassphrase() ([]byte, error) {
+	return readPassphrase("keyset passphrase: ", false)
+}
+
+// newKeysetPassphrase returns the passphrase to encrypt a keyset with. Passphrases
+// entered at a prompt must be confirmed.
+func newKeysetPassphrase() ([]byte, error) {
+	return readPassphrase("new keyset passphrase: ", true)
+}
+
+// readPassphrase reads a passphrase from, in order of precedence, --passphrase-fd,
+// the HASHMAP_KEYSET_PASSPHRASE environment variable, or a prompt on the terminal.
+func readPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if passphraseFD >= 0 {
+		return readPassphraseFD(passphraseFD)
+	}
+	if p, ok := os.LookupEnv(keysetPassphraseEnv); ok {
+		return []byte(p), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("keyset passphrase required: set %v, use --passphrase-fd or run in a terminal", keysetPassphraseEnv)
+	}
+	p, err := promptPassphrase(fd, prompt)
+	if err != nil || !confirm {
+		return p, err
+	}
+	c, err := promptPassphrase(fd, "confirm "+prompt)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(p, c) {
+		return nil, errors.New("keyset passphrases do not match")
+	}
+	return p, nil
+}
+
+// promptPassphrase writes prompt to stderr and reads a passphrase from the terminal
+// without echoing it
+func promptPassphrase(fd int, prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return p, err
+}
+
+// readPassphraseFD reads the first line of an open file descriptor
+func readPassphraseFD(fd int) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), "passphrase-fd")
+	if f == nil {
+		return nil, fmt.Errorf("invalid passphrase file descriptor: %d", fd)
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading passphrase file descriptor %d: %w", fd, err)
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,144 @@
+// This is free and unencumbered software released into the public domain.
+
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+
+// For more information, please refer to <http://unlicense.org>
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	client "github.com/nomasters/hashmap/pkg/client"
+	payload "github.com/nomasters/hashmap/pkg/payload"
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	"github.com/spf13/cobra"
+)
+
+var putMessage string
+var putTTL string
+var putKeysetPath string
+var putOutput string
+var putVersion int
+var putChain bool
+
+// putCmd represents the put command
+var putCmd = &cobra.Command{
+	Use:   "put",
+	Short: "signs a message with a keyset and submits it to a hashmap server",
+	Long: `signs a message with a keyset, or the signing agent started by hashmap agent,
+and submits it to a hashmap server.
+
+The raw output mode prints the endpoint the payload was published to, json prints
+the submitted payload and analyze prints an analysis of the submitted payload.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := put(cmd); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// put signs and submits a payload with the keyset or a signing agent. The keyset is
+// closed before the payload is printed, after its state has been persisted by signing.
+func put(cmd *cobra.Command) error {
+	if err := validateOutput(putOutput); err != nil {
+		return err
+	}
+	c, err := newClient(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	t, err := time.ParseDuration(putTTL)
+	if err != nil {
+		return err
+	}
+	v, err := parseVersion(putVersion)
+	if err != nil {
+		return err
+	}
+	signers, closeSigners, err := openSigners(cmd, putKeysetPath)
+	if err != nil {
+		return err
+	}
+	defer closeSigners()
+
+	ctx := context.Background()
+	opts := []payload.Option{payload.WithVersion(v), payload.WithTTL(t)}
+	if putChain {
+		o, err := chainOption(ctx, c, signers)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, o)
+	}
+	p, err := payload.Generate([]byte(putMessage), signers, opts...)
+	if err != nil {
+		return err
+	}
+	if err := c.Put(ctx, p); err != nil {
+		return err
+	}
+	if putOutput == outputRaw {
+		fmt.Println(p.Endpoint())
+		return nil
+	}
+	return printPayload(p, putOutput)
+}
+
+// chainOption returns the option that chains a payload to the payload published at
+// the endpoint of the signers, or that starts a chain if there is none
+func chainOption(ctx context.Context, c *client.Client, signers []sig.Signer) (payload.Option, error) {
+	keys, err := payload.SignerKeys(signers)
+	if err != nil {
+		return nil, err
+	}
+	var p payload.Payload
+	for _, k := range keys {
+		p.SigBundles = append(p.SigBundles, sig.Bundle{Alg: k.Alg, Pub: k.Pub})
+	}
+	prev, err := c.GetVerified(ctx, p.Endpoint())
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return payload.WithSequence(1), nil
+	case err != nil:
+		return nil, err
+	}
+	return payload.WithPrevious(prev), nil
+}
+
+func init() {
+	rootCmd.AddCommand(putCmd)
+
+	putCmd.Flags().StringVarP(&putMessage, "message", "m", "", "The message to be stored in data of payload")
+	putCmd.Flags().StringVarP(&putTTL, "ttl", "t", payload.DefaultTTL.String(), "ttl in XXhXXmXXs string format. Defaults to 24 hours")
+	putCmd.Flags().StringVarP(&putKeysetPath, "keyset", "k", "hashmap.keyset", "the path for the keyset file. Defaults `./hashmap.keyset`")
+	putCmd.Flags().IntVar(&putVersion, "payload-version", int(payload.V1), "the payload version: 1, or 3 for domain separated signatures")
+	putCmd.Flags().BoolVar(&putChain, "chain", false, "chains a version 3 payload to the payload published at the endpoint, or starts a chain")
+	addPassphraseFlags(putCmd.Flags())
+	addAgentFlags(putCmd.Flags())
+	addClientFlags(putCmd.Flags(), &putOutput)
+}
@@ -82,6 +82,16 @@ func initConfig() {
 	viper.BindEnv("server.tls", "HASHMAP_SERVER_TLS")
 	viper.BindEnv("server.certfile", "HASHMAP_SERVER_CERTFILE")
 	viper.BindEnv("server.keyfile", "HASHMAP_SERVER_KEYFILE")
+	viper.BindEnv("server.timeout", "HASHMAP_SERVER_TIMEOUT")
+	viper.BindEnv("server.throttle", "HASHMAP_SERVER_THROTTLE")
+	viper.BindEnv("server.throttleBacklog", "HASHMAP_SERVER_THROTTLEBACKLOG")
+	viper.BindEnv("server.baseRoute", "HASHMAP_SERVER_BASEROUTE")
+	viper.BindEnv("server.metrics", "HASHMAP_SERVER_METRICS")
+	viper.BindEnv("server.logFormat", "HASHMAP_SERVER_LOGFORMAT")
+	viper.BindEnv("server.logLevel", "HASHMAP_SERVER_LOGLEVEL")
+	viper.BindEnv("server.corsAllowedHeaders", "HASHMAP_SERVER_CORSALLOWEDHEADERS")
+	viper.BindEnv("server.corsAllowedOrigins", "HASHMAP_SERVER_CORSALLOWEDORIGINS")
+	viper.BindEnv("client.url", "HASHMAP_CLIENT_URL")
 	viper.BindEnv("storage.engine", "HASHMAP_STORAGE_ENGINE")
 	viper.BindEnv("storage.endpoint", "HASHMAP_STORAGE_ENDPOINT")
 	viper.BindEnv("storage.auth", "HASHMAP_STORAGE_AUTH")
@@ -91,6 +101,15 @@ func initConfig() {
 	viper.BindEnv("storage.wait", "HASHMAP_STORAGE_WAIT")
 	viper.BindEnv("storage.maxConnLifetime", "HASHMAP_STORAGE_MAXCONNLIFETIME")
 	viper.BindEnv("storage.tls", "HASHMAP_STORAGE_TLS")
+	viper.BindEnv("storage.tlsSkipVerify", "HASHMAP_STORAGE_TLSSKIPVERIFY")
+	viper.BindEnv("storage.table", "HASHMAP_STORAGE_TABLE")
+	viper.BindEnv("storage.region", "HASHMAP_STORAGE_REGION")
+	viper.BindEnv("storage.maxEntries", "HASHMAP_STORAGE_MAXENTRIES")
+	viper.BindEnv("storage.maxBytes", "HASHMAP_STORAGE_MAXBYTES")
+	viper.BindEnv("storage.eviction", "HASHMAP_STORAGE_EVICTION")
+	viper.BindEnv("storage.history", "HASHMAP_STORAGE_HISTORY")
+	viper.BindEnv("storage.path", "HASHMAP_STORAGE_PATH")
+	viper.BindEnv("storage.compactInterval", "HASHMAP_STORAGE_COMPACTINTERVAL")
 
 	viper.AutomaticEnv()
 
@@ -27,35 +27,221 @@ package cmd
 
 import (
 	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/nomasters/hashmap/internal/server"
+	"github.com/nomasters/hashmap/internal/storage"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Short: "runs a hashmap server",
+	Long: `runs a hashmap server.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+Settings are read, in order of precedence, from flags, HASHMAP_* environment
+variables, and the config file (./hashmap.yaml by default). For example:
+
+	server:
+	  host: 0.0.0.0
+	  port: 3000
+	  tls: true
+	  certfile: /etc/hashmap/cert.pem
+	  keyfile: /etc/hashmap/key.pem
+	  logFormat: json
+	storage:
+	  engine: redis
+	  endpoint: localhost:6379
+	  maxIdle: 10`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("run called")
+		opts, err := serverOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.Run(opts...)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 
-	// Here you will define your flags and configuration settings.
+	f := runCmd.Flags()
+	f.String("host", "", "the host address the server listens on")
+	f.Int("port", 3000, "the port the server listens on")
+	f.Bool("tls", false, "enables TLS, requires --certfile and --keyfile")
+	f.String("certfile", "", "the path to the TLS certificate file")
+	f.String("keyfile", "", "the path to the TLS key file")
+	f.Duration("timeout", 15*time.Second, "the request and shutdown timeout")
+	f.Int("throttle", 100, "the maximum number of concurrently processed requests")
+	f.Int("throttle-backlog", 100, "the maximum number of requests waiting to be processed")
+	f.String("base-route", "/", "the base route the server handlers are mounted on")
+	f.Bool("metrics", false, "enables the prometheus metrics endpoint at <base-route>/metrics")
+	f.String("log-format", "text", "the log output format: text or json")
+	f.String("log-level", "info", "the minimum log level: debug, info, warn or error")
+	f.StringSlice("cors-allowed-headers", []string{}, "comma separated list of CORS allowed headers. Defaults to *")
+	f.StringSlice("cors-allowed-origins", []string{}, "comma separated list of CORS allowed origins. Defaults to *")
+	f.String("storage-engine", "memory", "the storage engine: memory, redis, dynamo or disk")
+	f.String("storage-endpoint", "", "the storage endpoint address")
+	f.String("storage-auth", "", "the storage auth secret")
+	f.Int("storage-max-idle", 0, "the maximum number of idle storage connections")
+	f.Int("storage-max-active", 0, "the maximum number of active storage connections, 0 is unlimited")
+	f.Duration("storage-idle-timeout", 0, "the duration after which idle storage connections are closed")
+	f.Bool("storage-wait", false, "wait for a storage connection when max-active is reached")
+	f.Duration("storage-max-conn-lifetime", 0, "the maximum lifetime of a storage connection")
+	f.Bool("storage-tls", false, "enables TLS for storage connections")
+	f.Bool("storage-tls-skip-verify", false, "skips verification of the storage TLS certificate")
+	f.String("storage-table", "hashmap", "the dynamo table name")
+	f.String("storage-region", "", "the dynamo AWS region, defaults to the AWS environment")
+	f.Int("storage-max-entries", 0, "the maximum number of memory engine entries, 0 is unbounded")
+	f.Int("storage-max-bytes", 0, "the maximum bytes held by the memory engine, 0 is unbounded")
+	f.String("storage-eviction", "reject", "the memory engine policy when full: reject, or expiring to evict the entries closest to expiry, which loses their replay protection")
+	f.Int("storage-history", 0, "the number of payloads the memory and redis engines keep per endpoint for <base-route>/<hash>/history, 0 keeps only the current payload")
+	f.String("storage-path", "hashmap.db", "the disk database file path")
+	f.Duration("storage-compact-interval", time.Minute, "how often the disk engine removes expired entries")
+
+	for key, flag := range runFlagKeys {
+		viper.BindPFlag(key, f.Lookup(flag))
+	}
+}
+
+// runFlagKeys maps viper config keys to the run command flag names
+var runFlagKeys = map[string]string{
+	"server.host":               "host",
+	"server.port":               "port",
+	"server.tls":                "tls",
+	"server.certfile":           "certfile",
+	"server.keyfile":            "keyfile",
+	"server.timeout":            "timeout",
+	"server.throttle":           "throttle",
+	"server.throttleBacklog":    "throttle-backlog",
+	"server.baseRoute":          "base-route",
+	"server.metrics":            "metrics",
+	"server.logFormat":          "log-format",
+	"server.logLevel":           "log-level",
+	"server.corsAllowedHeaders": "cors-allowed-headers",
+	"server.corsAllowedOrigins": "cors-allowed-origins",
+	"storage.engine":            "storage-engine",
+	"storage.endpoint":          "storage-endpoint",
+	"storage.auth":              "storage-auth",
+	"storage.maxIdle":           "storage-max-idle",
+	"storage.maxActive":         "storage-max-active",
+	"storage.idleTimeout":       "storage-idle-timeout",
+	"storage.wait":              "storage-wait",
+	"storage.maxConnLifetime":   "storage-max-conn-lifetime",
+	"storage.tls":               "storage-tls",
+	"storage.tlsSkipVerify":     "storage-tls-skip-verify",
+	"storage.table":             "storage-table",
+	"storage.region":            "storage-region",
+	"storage.maxEntries":        "storage-max-entries",
+	"storage.maxBytes":          "storage-max-bytes",
+	"storage.eviction":          "storage-eviction",
+	"storage.history":           "storage-history",
+	"storage.path":              "storage-path",
+	"storage.compactInterval":   "storage-compact-interval",
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// runCmd.PersistentFlags().String("foo", "", "A help for foo")
+// serverOptions maps the viper configuration onto server and storage options. It
+// returns an error for settings that can not be mapped, such as an unknown engine.
+// Conflicting settings, such as tls without a certfile, are rejected by server.Run.
+func serverOptions() ([]server.Option, error) {
+	logger, err := newLogger(viper.GetString("server.logFormat"), viper.GetString("server.logLevel"))
+	if err != nil {
+		return nil, err
+	}
+	engine, err := storage.ParseEngine(viper.GetString("storage.engine"))
+	if err != nil {
+		return nil, err
+	}
+	storageOpts := []storage.Option{storage.WithEngine(engine)}
+	switch engine {
+	case storage.MemoryEngine:
+		policy, err := storage.ParseEvictionPolicy(viper.GetString("storage.eviction"))
+		if err != nil {
+			return nil, err
+		}
+		storageOpts = append(storageOpts, storage.WithMemoryOptions(
+			storage.WithMemoryMaxEntries(viper.GetInt("storage.maxEntries")),
+			storage.WithMemoryMaxBytes(viper.GetInt("storage.maxBytes")),
+			storage.WithMemoryEvictionPolicy(policy),
+			storage.WithMemoryHistory(viper.GetInt("storage.history")),
+		))
+	case storage.RedisEngine:
+		storageOpts = append(storageOpts, storage.WithRedisOptions(
+			storage.WithRedisEndpoint(viper.GetString("storage.endpoint")),
+			storage.WithRedisAuth(viper.GetString("storage.auth")),
+			storage.WithRedisMaxIdle(viper.GetInt("storage.maxIdle")),
+			storage.WithRedisMaxActive(viper.GetInt("storage.maxActive")),
+			storage.WithRedisIdleTimeout(viper.GetDuration("storage.idleTimeout")),
+			storage.WithRedisWait(viper.GetBool("storage.wait")),
+			storage.WithRedisMaxConnLifetime(viper.GetDuration("storage.maxConnLifetime")),
+			storage.WithRedisTLS(viper.GetBool("storage.tls")),
+			storage.WithRedisDialTLSSkipVerify(viper.GetBool("storage.tlsSkipVerify")),
+			storage.WithRedisHistory(viper.GetInt("storage.history")),
+		))
+	case storage.DynamoEngine:
+		storageOpts = append(storageOpts, storage.WithDynamoOptions(
+			storage.WithDynamoEndpoint(viper.GetString("storage.endpoint")),
+			storage.WithDynamoTable(viper.GetString("storage.table")),
+			storage.WithDynamoRegion(viper.GetString("storage.region")),
+		))
+	case storage.DiskEngine:
+		storageOpts = append(storageOpts, storage.WithDiskOptions(
+			storage.WithDiskPath(viper.GetString("storage.path")),
+			storage.WithDiskCompactInterval(viper.GetDuration("storage.compactInterval")),
+		))
+	}
+
+	return []server.Option{
+		server.WithHost(viper.GetString("server.host")),
+		server.WithPort(viper.GetInt("server.port")),
+		server.WithTLS(viper.GetBool("server.tls")),
+		server.WithCertFile(viper.GetString("server.certfile")),
+		server.WithKeyFile(viper.GetString("server.keyfile")),
+		server.WithTimeout(viper.GetDuration("server.timeout")),
+		server.WithThrottle(viper.GetInt("server.throttle")),
+		server.WithThrottleBacklog(viper.GetInt("server.throttleBacklog")),
+		server.WithBaseRoute(viper.GetString("server.baseRoute")),
+		server.WithMetrics(viper.GetBool("server.metrics")),
+		server.WithLogger(logger),
+		server.WithCorsAllowedHeaders(stringSlice("server.corsAllowedHeaders")),
+		server.WithCorsAllowedOrigins(stringSlice("server.corsAllowedOrigins")),
+		server.WithStorageOptions(storageOpts...),
+	}, nil
+}
+
+// newLogger returns a slog.Logger that writes to stderr in the text or json format
+// at the given minimum level
+func newLogger(format, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format: %q, must be text or json", format)
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// runCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// stringSlice returns a viper string slice for a key, splitting on commas so that
+// environment variables such as HASHMAP_SERVER_CORSALLOWEDORIGINS=a,b are supported.
+func stringSlice(key string) []string {
+	var o []string
+	for _, v := range viper.GetStringSlice(key) {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				o = append(o, s)
+			}
+		}
+	}
+	return o
 }
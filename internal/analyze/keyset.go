@@ -1,42 +1,89 @@
 package analyze
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
 	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
 )
 
+// KeySet is the analyze struct container for a keyset. It is built without
+// signing, so analyzing a keyset never consumes a one-time key.
 type KeySet struct {
 	Hash         string   `json:"pubkey_hash"`
+	Version      int      `json:"version"`
+	Legacy       bool     `json:"legacy,omitempty"`
+	Encrypted    bool     `json:"encrypted,omitempty"`
 	Signers      []Signer `json:"signers"`
 	Valid        bool     `json:"valid"`
 	ErrorMessage string   `json:"error_message,omitempty"`
 }
 
+// Signer describes a single signer in a keyset. Count is only set for stateful
+// signers, such as XMSS, and reports the remaining signatures as "XX of XXX".
+// Created is unset for keys migrated from a legacy gob keyset. PublicKey can be shared
+// with other operators to build a threshold policy.
 type Signer struct {
-	Type  string `json:"type"`
-	Count string `json:"count,omitempty"`
-	PQR   bool   `json:"pqr"`
+	Type      string    `json:"type"`
+	PublicKey sig.Bytes `json:"public_key,omitempty"`
+	Created   time.Time `json:"created,omitzero"`
+	Count     string    `json:"count,omitempty"`
+	PQR       bool      `json:"pqr"`
 }
 
-func NewKeySet(b []byte) (*KeySet, error) {
-	signers, err := sigutil.Decode(b)
+// NewKeySet decodes a keyset and returns an analysis of its signers and the
+// endpoint hash derived from their public keys. Legacy is set for gob keysets
+// written by earlier versions, which are reported in the current format version.
+// Encrypted keysets require sigutil.WithPassphrase.
+func NewKeySet(b []byte, opts ...sigutil.Option) (*KeySet, error) {
+	ks, err := sigutil.UnmarshalKeySet(b, opts...)
 	if err != nil {
 		return nil, err
 	}
-	m := []byte("hello, world")
-	sigBundles, err := sigutil.SignAll(m, signers)
+	signers, err := ks.Signers()
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO:
-	// write signer enum -> string function
-	// write a function to check state on XMSS, should output XX of XXX
-	// write a function for PQR metadata
-
-	// get pubkey hash
 	k := KeySet{
-		Hash:  sigutil.EncodedBundleHash(sigBundles),
-		Valid: sigutil.VerifyAll(m, sigBundles),
+		Version:   ks.Version,
+		Legacy:    sigutil.IsLegacyKeySet(b),
+		Encrypted: sigutil.IsEncryptedKeySet(b),
+	}
+	var bundles []sig.Bundle
+	var errs []string
+	for i, s := range signers {
+		keyer, ok := s.(sig.Keyer)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("signer %d: unknown signer type %T", i, s))
+			k.Signers = append(k.Signers, Signer{Type: fmt.Sprintf("%T", s)})
+			continue
+		}
+		alg := keyer.Alg()
+		signer := Signer{
+			Type:      alg.String(),
+			PublicKey: keyer.PublicKey(),
+			Created:   ks.Keys[i].Created,
+			PQR:       alg.PQR(),
+		}
+		if st, ok := s.(sig.Stateful); ok {
+			signer.Count = fmt.Sprintf("%d of %d", st.Remaining(), st.Capacity())
+			if st.Remaining() == 0 {
+				errs = append(errs, fmt.Sprintf("signer %d: %v", i, &sig.ExhaustedError{Alg: alg, Capacity: st.Capacity()}))
+			}
+		}
+		k.Signers = append(k.Signers, signer)
+		bundles = append(bundles, sig.Bundle{Alg: alg, Pub: keyer.PublicKey()})
+	}
+	if len(bundles) == len(signers) {
+		k.Hash = sigutil.EncodedBundleHash(bundles)
+	}
+	k.Valid = len(signers) > 0 && len(errs) == 0
+	if len(signers) == 0 {
+		errs = append(errs, "keyset contains no signers")
 	}
+	k.ErrorMessage = strings.Join(errs, "; ")
 	return &k, nil
 }
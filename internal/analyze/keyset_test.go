@@ -1,10 +1,15 @@
 package analyze
 
 import (
+	"encoding/binary"
 	"encoding/json"
-
+	"errors"
 	"io/ioutil"
 	"testing"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
 )
 
 func TestNewKeySet(t *testing.T) {
@@ -21,4 +26,69 @@ func TestNewKeySet(t *testing.T) {
 	output, err := json.Marshal(*k)
 	t.Log(string(output))
 
+	if !k.Valid || k.Hash == "" {
+		t.Error("expected valid keyset with endpoint hash")
+	}
+	if len(k.Signers) != 1 || k.Signers[0].Type != "nacl_sign" || k.Signers[0].PQR {
+		t.Errorf("unexpected signers: %+v", k.Signers)
+	}
+	if !k.Legacy || k.Version != sigutil.KeySetVersion || !k.Signers[0].Created.IsZero() {
+		t.Errorf("expected migrated legacy keyset: %+v", k)
+	}
+
+	t.Run("xmss", func(t *testing.T) {
+		x := sig.GenXMSS10()
+		pre := x.PrivateKey
+		b, err := sigutil.Encode([]sig.Signer{sig.GenNaclSign(), x})
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := NewKeySet(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.PrivateKey != pre {
+			t.Error("analysis should not advance xmss state")
+		}
+		s := k.Signers[1]
+		if s.Type != "xmss_sha2_10_256" || !s.PQR || s.Count != "1024 of 1024" {
+			t.Errorf("unexpected xmss signer: %+v", s)
+		}
+		if k.Legacy || s.Created.IsZero() {
+			t.Errorf("expected current keyset with creation time: %+v", k)
+		}
+
+		binary.BigEndian.PutUint32(x.PrivateKey[:4], 1024)
+		b, err = sigutil.Encode([]sig.Signer{x})
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err = NewKeySet(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.Valid || k.Signers[0].Count != "0 of 1024" {
+			t.Errorf("failed to report exhausted key: %+v", k)
+		}
+	})
+	t.Run("encrypted", func(t *testing.T) {
+		ks, err := sigutil.NewKeySet(sigutil.NewDefaultSigners(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := sigutil.EncryptKeySet(ks, []byte("hunter2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewKeySet(b); !errors.Is(err, sigutil.ErrPassphraseRequired) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		k, err := NewKeySet(b, sigutil.WithPassphrase(func() ([]byte, error) { return []byte("hunter2"), nil }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !k.Valid || !k.Encrypted {
+			t.Errorf("unexpected encrypted keyset analysis: %+v", k)
+		}
+	})
 }
@@ -1,9 +1,11 @@
 package analyze
 
 import (
+	"fmt"
 	"time"
 
 	payload "github.com/nomasters/hashmap/pkg/payload"
+	sig "github.com/nomasters/hashmap/pkg/sig"
 )
 
 // Payload is the analyze struct container for the standard
@@ -21,28 +23,84 @@ type Payload struct {
 	ValidSignatures    bool            `json:"valid_signatures"`
 	ValidDataSize      bool            `json:"valid_data_size"`
 	ValidPayloadSize   bool            `json:"valid_payload_size"`
+	Threshold          string          `json:"threshold,omitempty"`
+	Signatures         []Signature     `json:"signatures"`
+	Chain              *Chain          `json:"chain,omitempty"`
 	ErrorMessage       string          `json:"error_message,omitempty"`
 }
 
-// NewPayload returns a payload analysis and runs the entire validation suite on the output
-func NewPayload(b []byte) (*Payload, error) {
+// Chain is the analysis of the sequence and previous hash link of a chained payload.
+// Continuity is only checked if the previous payload is given with WithPrevious.
+type Chain struct {
+	Sequence     uint64        `json:"sequence"`
+	Hash         payload.Bytes `json:"hash"`
+	Prev         payload.Bytes `json:"prev,omitempty"`
+	Checked      bool          `json:"checked"`
+	Continuous   bool          `json:"continuous"`
+	Missed       uint64        `json:"missed"`
+	ErrorMessage string        `json:"error_message,omitempty"`
+}
+
+// PayloadOption is func signature used for setting NewPayload options
+type PayloadOption func(*payloadOptions)
+
+// payloadOptions holds the options of NewPayload
+type payloadOptions struct {
+	previous []byte
+}
+
+// WithPrevious sets the encoded payload that the analyzed payload replaces, and is
+// used to check the continuity of a chain.
+func WithPrevious(b []byte) PayloadOption {
+	return func(o *payloadOptions) {
+		o.previous = b
+	}
+}
+
+// Signature is the analysis of a single signature bundle of a payload, using the
+// sig algorithm registry for the algorithm name and post-quantum resistance.
+type Signature struct {
+	Alg          string `json:"alg"`
+	PQR          bool   `json:"pqr"`
+	Valid        bool   `json:"valid"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// NewPayload returns a payload analysis and runs the entire validation suite on the output.
+// The JSON or protobuf encoding of b, and of a previous payload, is detected automatically.
+func NewPayload(b []byte, opts ...PayloadOption) (*Payload, error) {
+	var o payloadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	var p Payload
-	pl, err := payload.Unmarshal(b)
+	f := payload.DetectFormat(b)
+	pl, err := payload.UnmarshalFormat(b, f)
 	if err != nil {
 		return nil, err
 	}
+	if pl.IsChained() || o.previous != nil {
+		p.Chain = &Chain{Sequence: pl.Sequence, Hash: pl.Hash(), Prev: pl.Prev}
+	}
+	if o.previous != nil {
+		prev, err := payload.UnmarshalFormat(o.previous, payload.DetectFormat(o.previous))
+		if err != nil {
+			return nil, fmt.Errorf("previous payload: %w", err)
+		}
+		p.Chain.check(pl, prev)
+	}
 	p.Raw = pl
 	p.Hash = pl.Endpoint()
 	p.Timestamp = pl.Timestamp
 	p.TTL = pl.TTL.String()
-	p.analyze(pl)
-	if err := pl.Verify(); err != nil {
+	p.analyze(pl, f)
+	if err := pl.Verify(payload.WithValidateFormat(f)); err != nil {
 		p.ErrorMessage = err.Error()
 	}
 	return &p, nil
 }
 
-func (p *Payload) analyze(pl payload.Payload) {
+func (p *Payload) analyze(pl payload.Payload, f payload.Format) {
 	now := time.Now()
 	p.Expired = pl.IsExpired(now)
 	p.ValidVersion = pl.ValidVersion()
@@ -51,5 +109,31 @@ func (p *Payload) analyze(pl payload.Payload) {
 	p.ValidTTL = pl.ValidTTL()
 	p.ValidSignatures = pl.VerifySignatures()
 	p.ValidDataSize = pl.ValidDataSize()
-	p.ValidPayloadSize = pl.ValidPayloadSize()
+	p.ValidPayloadSize = pl.ValidWireSize(f)
+	if pl.Policy != nil {
+		p.Threshold = fmt.Sprintf("%d of %d", pl.Policy.Threshold, len(pl.Policy.Keys))
+	}
+	m := pl.SigningBytes()
+	for _, b := range pl.SigBundles {
+		s := Signature{Alg: b.Alg.String(), PQR: b.Alg.PQR(), Valid: true}
+		if err := sig.VerifyBundle(m, b); err != nil {
+			s.Valid = false
+			s.ErrorMessage = err.Error()
+		}
+		p.Signatures = append(p.Signatures, s)
+	}
+}
+
+// check reports whether pl follows prev, and how many payloads are missing between
+// them if it does not
+func (c *Chain) check(pl, prev payload.Payload) {
+	c.Checked = true
+	c.Continuous = true
+	if err := pl.Follows(prev); err != nil {
+		c.Continuous = false
+		c.ErrorMessage = err.Error()
+	}
+	if pl.Sequence > prev.Sequence+1 {
+		c.Missed = pl.Sequence - prev.Sequence - 1
+	}
 }
@@ -2,7 +2,12 @@ package analyze
 
 import (
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
+
+	payload "github.com/nomasters/hashmap/pkg/payload"
+	sig "github.com/nomasters/hashmap/pkg/sig"
 )
 
 func TestNewPayload(t *testing.T) {
@@ -15,3 +20,106 @@ func TestNewPayload(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestNewPayloadProtobuf(t *testing.T) {
+	b, err := ioutil.ReadFile("../../test/testdata/valid_payload_expired.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := payload.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := payload.MarshalProto(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewPayload(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.ValidSignatures || a.Hash != p.Endpoint() {
+		t.Errorf("unexpected analysis: %+v", a)
+	}
+}
+
+func TestNewPayloadSignatures(t *testing.T) {
+	b, err := ioutil.ReadFile("../../test/testdata/valid_payload_expired.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := payload.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SigBundles = append(p.SigBundles, sig.Bundle{Alg: 99, Pub: []byte("pub"), Sig: []byte("sig")})
+	pb, err := payload.MarshalProto(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewPayload(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Signatures) != 2 {
+		t.Fatalf("signature count: %v", len(a.Signatures))
+	}
+	if s := a.Signatures[0]; !s.Valid || s.Alg != "nacl_sign" || s.PQR {
+		t.Errorf("unexpected signature: %+v", s)
+	}
+	if s := a.Signatures[1]; s.Valid || s.Alg != "unknown_alg_99" || !strings.Contains(s.ErrorMessage, "unknown algorithm") {
+		t.Errorf("unexpected signature: %+v", s)
+	}
+}
+
+func TestNewPayloadChain(t *testing.T) {
+	signers := []sig.Signer{sig.GenNaclSign()}
+	now := time.Now()
+	encode := func(opts ...payload.Option) ([]byte, payload.Payload) {
+		p, err := payload.Generate([]byte("chained"), signers, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := payload.MarshalProto(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b, p
+	}
+	firstBytes, first := encode(payload.WithSequence(1), payload.WithTimestamp(now))
+	secondBytes, _ := encode(payload.WithPrevious(first), payload.WithTimestamp(now.Add(time.Second)))
+	fourthBytes, _ := encode(payload.WithSequence(4), payload.WithTimestamp(now.Add(2*time.Second)))
+
+	tests := []struct {
+		description string
+		b           []byte
+		opts        []PayloadOption
+		checked     bool
+		continuous  bool
+		missed      uint64
+	}{
+		{description: "unchecked", b: secondBytes},
+		{description: "continuous", b: secondBytes, opts: []PayloadOption{WithPrevious(firstBytes)}, checked: true, continuous: true},
+		{description: "missed", b: fourthBytes, opts: []PayloadOption{WithPrevious(firstBytes)}, checked: true, missed: 2},
+	}
+	for _, test := range tests {
+		a, err := NewPayload(test.b, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := a.Chain
+		if c == nil {
+			t.Errorf("%v: missing chain analysis", test.description)
+			continue
+		}
+		if c.Checked != test.checked || c.Continuous != test.continuous || c.Missed != test.missed {
+			t.Errorf("%v: unexpected chain analysis: %+v", test.description, c)
+		}
+		if test.checked && !test.continuous && c.ErrorMessage == "" {
+			t.Errorf("%v: missing error message", test.description)
+		}
+	}
+	if _, err := NewPayload(secondBytes, WithPrevious([]byte{0xff})); err == nil {
+		t.Error("failed to catch malformed previous payload")
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nomasters/hashmap/internal/storage"
+	"github.com/nomasters/hashmap/pkg/payload"
+)
+
+// Error codes are the machine-readable values of errorResponse.Code
+const (
+	codeBadRequest      = "bad_request"
+	codeNotFound        = "not_found"
+	codeStaleTimestamp  = "stale_timestamp"
+	codeConflict        = "conflict"
+	codeBrokenChain     = "broken_chain"
+	codePayloadTooLarge = "payload_too_large"
+	codeInvalidPayload  = "invalid_payload"
+	codeUnavailable     = "unavailable"
+	codeInternal        = "internal_error"
+)
+
+// verifyReasons maps payload verification errors to the reason reported by
+// the request log and the verification failure counter
+var verifyReasons = []struct {
+	err    error
+	reason string
+}{
+	{payload.ErrInvalidEndpoint, "invalid_endpoint"},
+	{payload.ErrMaxPayloadSize, "max_payload_size"},
+	{payload.ErrMaxMessageSize, "max_message_size"},
+	{payload.ErrInvalidVersion, "invalid_version"},
+	{payload.ErrExpired, "expired"},
+	{payload.ErrInvalidTTL, "invalid_ttl"},
+	{payload.ErrInvalidChain, "invalid_chain"},
+	{payload.ErrFutureTimestamp, "future_timestamp"},
+	{payload.ErrSubmitWindow, "submit_window"},
+	{payload.ErrInvalidSignatures, "invalid_signatures"},
+}
+
+// verifyReason returns the reason for a payload verification error
+func verifyReason(err error) string {
+	for _, v := range verifyReasons {
+		if errors.Is(err, v.err) {
+			return v.reason
+		}
+	}
+	return "other"
+}
+
+// errorResponse is the JSON body written for all failed requests
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError adds err to the request log line and writes a JSON errorResponse with the
+// status and code. The message of server errors is the status text so that backend
+// details are not leaked.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, err error) {
+	if f := requestLogFields(r); f != nil {
+		f.err = err
+	}
+	msg := http.StatusText(status)
+	if status < 500 && err != nil {
+		msg = err.Error()
+	}
+	b, _ := json.Marshal(errorResponse{Code: code, Message: msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// storageError writes the response for an error returned by storage Get or Set
+func storageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, codeNotFound, err)
+	case errors.Is(err, storage.ErrStaleTimestamp):
+		writeError(w, r, http.StatusConflict, codeStaleTimestamp, err)
+	case errors.Is(err, storage.ErrConflict):
+		writeError(w, r, http.StatusConflict, codeConflict, err)
+	case errors.Is(err, storage.ErrFull), errors.Is(err, storage.ErrUnavailable):
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, err)
+	default:
+		writeError(w, r, http.StatusInternalServerError, codeInternal, err)
+	}
+}
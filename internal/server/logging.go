@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// logFields holds the attributes that handlers add to the request log line
+type logFields struct {
+	endpoint string
+	reason   string
+	err      error
+}
+
+// logFieldsKey is the context key for a request's logFields
+type logFieldsKey struct{}
+
+// requestLogger returns middleware that writes one log line per request with the
+// request ID set by middleware.RequestID, the client IP, status and latency, and
+// the endpoint, failure reason and error set by the handlers. Server errors are
+// logged at error level and client errors at warn level.
+func requestLogger(l *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := middleware.GetReqID(r.Context())
+			w.Header().Set(middleware.RequestIDHeader, id)
+			f := &logFields{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), logFieldsKey{}, f)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			attrs := []slog.Attr{
+				slog.String("request_id", id),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.String("client_ip", clientIP(r)),
+				slog.Duration("latency", time.Since(start)),
+			}
+			if f.endpoint != "" {
+				attrs = append(attrs, slog.String("endpoint", f.endpoint))
+			}
+			if f.reason != "" {
+				attrs = append(attrs, slog.String("reason", f.reason))
+			}
+			if f.err != nil {
+				attrs = append(attrs, slog.String("error", f.err.Error()))
+			}
+			level := slog.LevelInfo
+			switch {
+			case status >= 500:
+				level = slog.LevelError
+			case status >= 400:
+				level = slog.LevelWarn
+			}
+			l.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+// requestLogFields returns the logFields of a request, or nil if the request was
+// not served through requestLogger
+func requestLogFields(r *http.Request) *logFields {
+	f, _ := r.Context().Value(logFieldsKey{}).(*logFields)
+	return f
+}
+
+// logEndpoint sets the endpoint attribute of the request log line
+func logEndpoint(r *http.Request, endpoint string) {
+	if f := requestLogFields(r); f != nil {
+		f.endpoint = endpoint
+	}
+}
+
+// logVerifyFailure sets the reason attribute of the request log line
+func logVerifyFailure(r *http.Request, err error) {
+	if f := requestLogFields(r); f != nil {
+		f.reason = verifyReason(err)
+	}
+}
+
+// clientIP returns the host of the request remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nomasters/hashmap/internal/storage"
+	"github.com/nomasters/hashmap/pkg/payload"
+	"github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestRequestLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	s := storage.NewMemoryStore()
+	defer s.Close()
+	h := newRouter(s, parseOptions(WithLogger(slog.New(slog.NewJSONHandler(&buf, nil)))))
+
+	p, err := payload.Generate([]byte("hello"), []sig.Signer{sig.GenNaclSign()}, payload.WithTimestamp(time.Now().Add(-time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := payload.MarshalProto(p)
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(b))
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Content-Type", payload.ContentTypeProtobuf)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status: %v", w.Code)
+	}
+
+	var line struct {
+		Level     string `json:"level"`
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		Status    int    `json:"status"`
+		ClientIP  string `json:"client_ip"`
+		Latency   *int64 `json:"latency"`
+		Endpoint  string `json:"endpoint"`
+		Reason    string `json:"reason"`
+		Error     string `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Level != "WARN" || line.Msg != "request" || line.Status != http.StatusUnprocessableEntity {
+		t.Errorf("unexpected log line: %s", buf.Bytes())
+	}
+	if line.RequestID == "" || line.RequestID != w.Header().Get("X-Request-Id") {
+		t.Errorf("request id: %q, header: %q", line.RequestID, w.Header().Get("X-Request-Id"))
+	}
+	if line.ClientIP != "192.0.2.1" {
+		t.Errorf("client ip: %v", line.ClientIP)
+	}
+	if line.Latency == nil {
+		t.Error("missing latency")
+	}
+	if line.Endpoint != p.Endpoint() {
+		t.Errorf("endpoint: %v", line.Endpoint)
+	}
+	if line.Reason != "submit_window" {
+		t.Errorf("reason: %v", line.Reason)
+	}
+	if line.Error == "" {
+		t.Error("missing error")
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nomasters/hashmap/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "hashmap"
+
+// metrics holds the prometheus collectors for a router. Each router has its own
+// registry so that multiple routers, such as in tests, do not collide.
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	verifyFailures  *prometheus.CounterVec
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+}
+
+// newMetrics returns metrics registered with a new registry, including gauges for
+// the entry and byte counts of a MemoryStore and the pool connections of a RedisStore.
+func newMetrics(s storage.GetSetCloser) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Total HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		verifyFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "verification_failures_total",
+			Help:      "Total payload verification failures by reason.",
+		}, []string{"reason"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Storage operation latency by engine and operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"engine", "op"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "storage_errors_total",
+			Help:      "Total storage operation errors by engine, operation and error.",
+		}, []string{"engine", "op", "error"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.verifyFailures,
+		m.storageDuration,
+		m.storageErrors,
+	)
+
+	switch s := s.(type) {
+	case *storage.MemoryStore:
+		m.registry.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "memory_entries",
+				Help:      "Number of entries held by the memory store.",
+			}, func() float64 {
+				entries, _ := s.Len()
+				return float64(entries)
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "memory_bytes",
+				Help:      "Bytes of keys and payloads held by the memory store.",
+			}, func() float64 {
+				_, bytes := s.Len()
+				return float64(bytes)
+			}),
+		)
+	case *storage.RedisStore:
+		m.registry.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "redis_pool_active_connections",
+				Help:      "Number of connections in the redis pool, including idle connections.",
+			}, func() float64 {
+				active, _ := s.PoolStats()
+				return float64(active)
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "redis_pool_idle_connections",
+				Help:      "Number of idle connections in the redis pool.",
+			}, func() float64 {
+				_, idle := s.PoolStats()
+				return float64(idle)
+			}),
+		)
+	}
+	return m
+}
+
+// handler returns the http.Handler that serves the metrics registry
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// middleware records the count and latency of requests. The route label is the
+// matched chi route pattern so that endpoint hashes do not create new series.
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// verifyFailure increments the verification failure counter for the reason of err.
+// It is safe to call on a nil metrics.
+func (m *metrics) verifyFailure(err error) {
+	if m == nil {
+		return
+	}
+	m.verifyFailures.WithLabelValues(verifyReason(err)).Inc()
+}
+
+// instrumentedStore wraps a storage.GetSetCloser and records the latency and errors
+// of Get and Set calls
+type instrumentedStore struct {
+	storage.GetSetCloser
+	engine string
+	m      *metrics
+}
+
+// instrument returns s wrapped with an instrumentedStore, which also implements
+// storage.CompareAndSetter if s does, and storage.Lister if s implements both
+func (m *metrics) instrument(s storage.GetSetCloser) storage.GetSetCloser {
+	i := instrumentedStore{GetSetCloser: s, engine: engineName(s), m: m}
+	_, cas := s.(storage.CompareAndSetter)
+	_, lister := s.(storage.Lister)
+	switch {
+	case cas && lister:
+		return instrumentedListStore{instrumentedCASStore{i}}
+	case cas:
+		return instrumentedCASStore{i}
+	}
+	return i
+}
+
+// Get calls Get on the wrapped store and records its latency and error
+func (s instrumentedStore) Get(key string) ([]byte, error) {
+	start := time.Now()
+	b, err := s.GetSetCloser.Get(key)
+	s.observe("get", start, err)
+	return b, err
+}
+
+// Set calls Set on the wrapped store and records its latency and error
+func (s instrumentedStore) Set(key string, value []byte, ttl time.Duration, timestamp time.Time) error {
+	start := time.Now()
+	err := s.GetSetCloser.Set(key, value, ttl, timestamp)
+	s.observe("set", start, err)
+	return err
+}
+
+// instrumentedCASStore is an instrumentedStore for a storage.CompareAndSetter
+type instrumentedCASStore struct {
+	instrumentedStore
+}
+
+// CompareAndSet calls CompareAndSet on the wrapped store and records its latency and
+// error as a set
+func (s instrumentedCASStore) CompareAndSet(key string, old, value []byte, ttl time.Duration, timestamp time.Time) error {
+	start := time.Now()
+	err := s.GetSetCloser.(storage.CompareAndSetter).CompareAndSet(key, old, value, ttl, timestamp)
+	s.observe("set", start, err)
+	return err
+}
+
+// instrumentedListStore is an instrumentedCASStore for a storage.Lister
+type instrumentedListStore struct {
+	instrumentedCASStore
+}
+
+// List calls List on the wrapped store and records its latency and error
+func (s instrumentedListStore) List(key string) ([][]byte, error) {
+	start := time.Now()
+	values, err := s.GetSetCloser.(storage.Lister).List(key)
+	s.observe("list", start, err)
+	return values, err
+}
+
+// observe records the latency of an operation and, if err is not nil, its error
+func (s instrumentedStore) observe(op string, start time.Time, err error) {
+	s.m.storageDuration.WithLabelValues(s.engine, op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.m.storageErrors.WithLabelValues(s.engine, op, storageErrorLabel(err)).Inc()
+	}
+}
+
+// storageErrorLabel returns the error label for a storage error
+func storageErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, storage.ErrStaleTimestamp):
+		return "stale_timestamp"
+	case errors.Is(err, storage.ErrConflict):
+		return "conflict"
+	case errors.Is(err, storage.ErrFull):
+		return "full"
+	case errors.Is(err, storage.ErrUnavailable):
+		return "unavailable"
+	}
+	return "other"
+}
+
+// engineName returns the engine label for a store
+func engineName(s storage.GetSetCloser) string {
+	switch s.(type) {
+	case *storage.MemoryStore:
+		return "memory"
+	case *storage.RedisStore:
+		return "redis"
+	case *storage.DynamoStore:
+		return "dynamo"
+	case *storage.DiskStore:
+		return "disk"
+	}
+	return "unknown"
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nomasters/hashmap/internal/storage"
+	"github.com/nomasters/hashmap/pkg/payload"
+	"github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	scrape := func(h http.Handler, route string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", route, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("metrics status: %v", w.Code)
+		}
+		return w.Body.String()
+	}
+	contains := func(body string, lines ...string) {
+		for _, l := range lines {
+			if !strings.Contains(body, l) {
+				t.Errorf("metrics missing: %v", l)
+			}
+		}
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		t.Parallel()
+
+		s := storage.NewMemoryStore()
+		defer s.Close()
+		h := newRouter(s, parseOptions(WithMetrics(true), WithBaseRoute("/v1")))
+
+		signers := []sig.Signer{sig.GenNaclSign()}
+		p, err := payload.Generate([]byte("hello"), signers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale, err := payload.Generate([]byte("hello"), signers, payload.WithTimestamp(time.Now().Add(-time.Hour)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []payload.Payload{p, stale} {
+			b, _ := payload.MarshalProto(p)
+			req := httptest.NewRequest("POST", "/v1/", bytes.NewReader(b))
+			req.Header.Set("Content-Type", payload.ContentTypeProtobuf)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/"+p.Endpoint(), nil))
+
+		contains(scrape(h, "/v1/metrics"),
+			`hashmap_http_requests_total{method="POST",route="/v1",status="200"} 1`,
+			`hashmap_http_requests_total{method="POST",route="/v1",status="422"} 1`,
+			`hashmap_http_requests_total{method="GET",route="/v1/{hash}",status="200"} 1`,
+			`hashmap_http_request_duration_seconds_count{method="GET",route="/v1/{hash}",status="200"} 1`,
+			`hashmap_verification_failures_total{reason="submit_window"} 1`,
+			`hashmap_storage_operation_duration_seconds_count{engine="memory",op="set"} 1`,
+			`hashmap_storage_operation_duration_seconds_count{engine="memory",op="get"} 2`,
+			`hashmap_storage_errors_total{engine="memory",error="not_found",op="get"} 1`,
+			"hashmap_memory_entries 1",
+			"hashmap_memory_bytes ",
+		)
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		t.Parallel()
+
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mr.Close()
+		s := storage.NewRedisStore(storage.WithRedisEndpoint(mr.Addr()), storage.WithRedisMaxIdle(1))
+		defer s.Close()
+		h := newRouter(s, parseOptions(WithMetrics(true)))
+
+		p, err := payload.Generate([]byte("hello"), []sig.Signer{sig.GenNaclSign()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/"+p.Endpoint(), nil))
+
+		contains(scrape(h, "/metrics"),
+			`hashmap_storage_errors_total{engine="redis",error="not_found",op="get"} 1`,
+			"hashmap_redis_pool_active_connections 1",
+			"hashmap_redis_pool_idle_connections 1",
+		)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		s := storage.NewMemoryStore()
+		defer s.Close()
+		ts := httptest.NewServer(newRouter(s, parseOptions()))
+		defer ts.Close()
+		resp, err := http.Get(ts.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusOK {
+			t.Error("metrics served when disabled")
+		}
+	})
+}
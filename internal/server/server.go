@@ -3,13 +3,17 @@ package server
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -37,9 +41,14 @@ func Run(options ...Option) {
 	var srv http.Server
 
 	o := parseOptions(options...)
-	s, err := storage.New(o.storage...)
+	if err := o.validate(); err != nil {
+		o.logger.Error("invalid server options", "error", err)
+		os.Exit(1)
+	}
+	s, err := storage.New(append([]storage.Option{storage.WithLogger(o.logger)}, o.storage...)...)
 	if err != nil {
-		log.Fatal(err)
+		o.logger.Error("storage setup failed", "error", err)
+		os.Exit(1)
 	}
 	defer s.Close()
 
@@ -55,24 +64,24 @@ func Run(options ...Option) {
 		defer cancel()
 		// We received an interrupt signal, shut down.
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("SERVER SHUTDOWN ERROR: %v", err)
+			o.logger.Error("server shutdown failed", "error", err)
 		}
 		close(idleConnsClosed)
 	}()
 
-	log.Printf("Server started on: %v\n", o.addrString())
+	o.logger.Info("server started", "addr", o.addrString(), "tls", o.tls)
 	if o.tls {
 		if err := srv.ListenAndServeTLS(o.certFile, o.keyFile); err != http.ErrServerClosed {
-			log.Printf("SERVER ERROR: %v", err)
+			o.logger.Error("server error", "error", err)
 		}
 	} else {
-		log.Println("WARNING: running in NON-TLS MODE")
+		o.logger.Warn("running in NON-TLS MODE")
 		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			log.Printf("SERVER ERROR: %v", err)
+			o.logger.Error("server error", "error", err)
 		}
 	}
 	<-idleConnsClosed
-	log.Println("\n...shutdown complete")
+	o.logger.Info("shutdown complete")
 }
 
 // Option is func signature used for setting Server Options
@@ -92,6 +101,8 @@ type options struct {
 	allowedHeaders []string
 	allowedOrigins []string
 	baseRoute      string
+	metrics        bool
+	logger         *slog.Logger
 }
 
 // addrString returns a string formatted as expected by the net libraries in go.
@@ -103,87 +114,223 @@ func (o options) addrString() string {
 	return fmt.Sprintf("%v:%v", o.host, port)
 }
 
+// newRouter returns the router for the payload handlers. When metrics are enabled the
+// store is instrumented and the metrics are served under the base route at /metrics.
 func newRouter(s storage.GetSetCloser, o options) http.Handler {
+	var m *metrics
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(requestLogger(o.logger))
+	if o.metrics {
+		m = newMetrics(s)
+		s = m.instrument(s)
+		r.Use(m.middleware)
+	}
 	r.Use(newCors(o.allowedHeaders, o.allowedOrigins).Handler)
 	r.Use(middleware.Timeout(o.timeout))
 	r.Use(middleware.ThrottleBacklog(o.limit, o.backlog, o.timeout))
 	r.Route(o.baseRoute, func(r chi.Router) {
-		r.Use(middleware.Heartbeat("/health"))
-		r.Post("/", postPayloadHandler(s))
-		r.Get("/{hash}", getPayloadByHashHandler(s))
+		r.Use(middleware.Heartbeat(path.Join(o.baseRoute, "health")))
+		if m != nil {
+			r.Method("GET", "/metrics", m.handler())
+		}
+		r.Post("/", postPayloadHandler(s, m))
+		r.Get("/{hash}", getPayloadByHashHandler(s, m))
+		if l, ok := s.(storage.Lister); ok {
+			r.Get("/{hash}/history", getHistoryByHashHandler(l, m))
+		}
 	})
 	return r
 }
 
-// badRequest silently returns 400 and logs error
-func badRequest(w http.ResponseWriter, v ...interface{}) {
-	if len(v) > 0 {
-		log.Println(v...)
-	}
-	http.Error(w, http.StatusText(400), http.StatusBadRequest)
-}
-
-// postPayloadHandler takes a storage.Setter and returns a http.HandlerFunc that
+// postPayloadHandler takes a storage.GetSetCloser and returns a http.HandlerFunc that
 // uses a limited reader set to payload.MaxPayloadSize and attempts to verify
 // and validate the payload in ServerMode. ServerMode verification adds an additional
 // time horizon check to ensure that a payload is only written to storage within a
-// strict time horizon.
-func postPayloadHandler(s storage.Setter) http.HandlerFunc {
+// strict time horizon. The request Content-Type selects the payload codec and the
+// payload is stored in the canonical protobuf encoding, if it follows the payload
+// stored at its endpoint.
+func postPayloadHandler(s storage.GetSetCloser, m *metrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		l := &io.LimitedReader{R: r.Body, N: payload.MaxPayloadSize}
+		l := &io.LimitedReader{R: r.Body, N: payload.MaxPayloadSize + 1}
 		body, err := ioutil.ReadAll(l)
 		if err != nil {
-			badRequest(w, "read error: ", err)
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Errorf("read error: %v", err))
+			return
+		}
+		if len(body) > payload.MaxPayloadSize {
+			writeError(w, r, http.StatusRequestEntityTooLarge, codePayloadTooLarge, payload.ErrMaxPayloadSize)
 			return
 		}
-		p, err := payload.Unmarshal(body)
+		f := payload.FormatFromContentType(r.Header.Get("Content-Type"))
+		p, err := payload.UnmarshalFormat(body, f)
 		if err != nil {
-			badRequest(w, err)
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, err)
 			return
 		}
-		if err := p.Verify(payload.WithServerMode(true)); err != nil {
-			badRequest(w, err)
+		logEndpoint(r, p.Endpoint())
+		if !p.ValidWireSize(f) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, codePayloadTooLarge, payload.ErrMaxPayloadSize)
 			return
 		}
-		k := p.Endpoint()
-		if err := s.Set(k, body, p.TTL, p.Timestamp); err != nil {
-			badRequest(w, err)
+		if err := p.Verify(payload.WithServerMode(true), payload.WithValidateFormat(f)); err != nil {
+			m.verifyFailure(err)
+			logVerifyFailure(r, err)
+			writeError(w, r, http.StatusUnprocessableEntity, codeInvalidPayload, err)
+			return
+		}
+		pb, err := payload.MarshalProto(p)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, codeInternal, err)
+			return
+		}
+		if err := storePayload(s, p, pb); err != nil {
+			if errors.Is(err, payload.ErrBrokenChain) {
+				writeError(w, r, http.StatusConflict, codeBrokenChain, err)
+				return
+			}
+			storageError(w, r, err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func getPayloadByHashHandler(s storage.Getter) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		k := chi.URLParam(r, "hash")
-		if len(k) != endpointHashLength {
-			badRequest(w, "get error. invalid hash length for:", k)
-			return
+// storePayload writes pb, the encoded payload p, to s if p follows the unexpired
+// payload stored at its endpoint. When s implements storage.CompareAndSetter the
+// stored payload is only replaced if it has not changed since it was checked, so
+// concurrent writes can not break a chain. A stored value that can not be decoded
+// is not checked and is overwritten.
+func storePayload(s storage.GetSetCloser, p payload.Payload, pb []byte) error {
+	k := p.Endpoint()
+	old, err := s.Get(k)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		old = nil
+	case err != nil:
+		return err
+	default:
+		prev, err := payload.UnmarshalFormat(old, payload.DetectFormat(old))
+		if err != nil || prev.IsExpired(time.Now()) {
+			break
+		}
+		if !p.Timestamp.After(prev.Timestamp) {
+			return storage.ErrStaleTimestamp
 		}
-		if _, err := base64.URLEncoding.DecodeString(k); err != nil {
-			badRequest(w, "get error. base64 decode failed for:", k, err)
+		if err := p.Follows(prev); err != nil {
+			return err
+		}
+	}
+	if c, ok := s.(storage.CompareAndSetter); ok {
+		return c.CompareAndSet(k, old, pb, p.TTL, p.Timestamp)
+	}
+	return s.Set(k, pb, p.TTL, p.Timestamp)
+}
+
+// getPayloadByHashHandler takes a storage.Getter and returns a http.HandlerFunc that
+// verifies the stored payload against the requested endpoint and writes it in the
+// codec selected by the Accept header. Entries stored as JSON by earlier versions
+// are detected and still served.
+func getPayloadByHashHandler(s storage.Getter, m *metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k, ok := hashParam(w, r)
+		if !ok {
 			return
 		}
 		pb, err := s.Get(k)
 		if err != nil {
-			badRequest(w, "get error. storage get error for:", k, err)
+			storageError(w, r, err)
 			return
 		}
-		p, err := payload.Unmarshal(pb)
+		p, err := payload.UnmarshalFormat(pb, payload.DetectFormat(pb))
 		if err != nil {
-			badRequest(w, "get error. payload unmarshal failed for:", k, err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, fmt.Errorf("payload unmarshal failed for: %v: %v", k, err))
+			return
+		}
+		if p.IsExpired(time.Now()) {
+			writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Errorf("payload ttl is expired for: %v", k))
 			return
 		}
 		if err := p.Verify(payload.WithValidateEndpoint(k)); err != nil {
-			badRequest(w, "failed get verify", k, err)
+			m.verifyFailure(err)
+			logVerifyFailure(r, err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, fmt.Errorf("failed get verify for: %v: %v", k, err))
 			return
 		}
-		w.Write(pb)
+		f := payload.FormatFromAccept(r.Header.Get("Accept"))
+		b, err := payload.MarshalFormat(p, f)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, codeInternal, fmt.Errorf("payload marshal failed for: %v: %v", k, err))
+			return
+		}
+		w.Header().Set("Content-Type", f.ContentType())
+		w.Write(b)
 	}
 }
 
+// getHistoryByHashHandler takes a storage.Lister and returns a http.HandlerFunc that
+// writes the unexpired payloads retained for the requested endpoint, newest first, as
+// a JSON array. Each payload is verified against the endpoint.
+func getHistoryByHashHandler(l storage.Lister, m *metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k, ok := hashParam(w, r)
+		if !ok {
+			return
+		}
+		values, err := l.List(k)
+		if err != nil {
+			storageError(w, r, err)
+			return
+		}
+		now := time.Now()
+		history := []payload.Payload{}
+		for _, pb := range values {
+			p, err := payload.UnmarshalFormat(pb, payload.DetectFormat(pb))
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, codeInternal, fmt.Errorf("payload unmarshal failed for: %v: %v", k, err))
+				return
+			}
+			if p.IsExpired(now) {
+				continue
+			}
+			if err := p.Verify(payload.WithValidateEndpoint(k)); err != nil {
+				m.verifyFailure(err)
+				logVerifyFailure(r, err)
+				writeError(w, r, http.StatusInternalServerError, codeInternal, fmt.Errorf("failed history verify for: %v: %v", k, err))
+				return
+			}
+			history = append(history, p)
+		}
+		if len(history) == 0 {
+			writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Errorf("payload ttl is expired for: %v", k))
+			return
+		}
+		b, err := json.Marshal(history)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, codeInternal, fmt.Errorf("history marshal failed for: %v: %v", k, err))
+			return
+		}
+		w.Header().Set("Content-Type", payload.ContentTypeJSON)
+		w.Write(b)
+	}
+}
+
+// hashParam returns the endpoint hash URL parameter, or writes a bad request error
+// and returns false if it is not a valid endpoint
+func hashParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	k := chi.URLParam(r, "hash")
+	logEndpoint(r, k)
+	if len(k) != endpointHashLength {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Errorf("invalid hash length for: %v", k))
+		return "", false
+	}
+	if _, err := base64.URLEncoding.DecodeString(k); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Errorf("base64 decode failed for: %v", k))
+		return "", false
+	}
+	return k, true
+}
+
 // newCors returns cors settings with optional
 func newCors(headers, origins []string) *cors.Cors {
 	if len(origins) == 0 {
@@ -209,6 +356,7 @@ func parseOptions(opts ...Option) (o options) {
 		limit:     defaultThrottleLimit,
 		backlog:   defaultThrottleBacklog,
 		baseRoute: "/",
+		logger:    slog.Default(),
 	}
 	for _, option := range opts {
 		option(&o)
@@ -221,6 +369,37 @@ func parseOptions(opts ...Option) (o options) {
 	return
 }
 
+// validate checks options for invalid or conflicting settings that would otherwise
+// cause the server to fail, or panic, after it has started accepting connections.
+func (o options) validate() error {
+	if o.port < 0 || o.port > 65535 {
+		return fmt.Errorf("invalid port: %v", o.port)
+	}
+	if o.timeout <= 0 {
+		return fmt.Errorf("invalid timeout: %v", o.timeout)
+	}
+	if o.limit <= 0 {
+		return fmt.Errorf("invalid throttle limit: %v", o.limit)
+	}
+	if o.backlog < 0 {
+		return fmt.Errorf("invalid throttle backlog: %v", o.backlog)
+	}
+	if !strings.HasPrefix(o.baseRoute, "/") {
+		return fmt.Errorf("invalid base route: %q must begin with /", o.baseRoute)
+	}
+	if o.tls {
+		if o.certFile == "" || o.keyFile == "" {
+			return errors.New("tls requires both a certfile and keyfile")
+		}
+		for _, f := range []string{o.certFile, o.keyFile} {
+			if _, err := os.Stat(f); err != nil {
+				return fmt.Errorf("tls file error: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
 // WithCorsAllowedHeaders takes cors pointer and returns an Option func for setting cors
 func WithCorsAllowedHeaders(headers []string) Option {
 	return func(o *options) {
@@ -306,3 +485,19 @@ func WithBaseRoute(b string) Option {
 		o.baseRoute = b
 	}
 }
+
+// WithMetrics takes a boolean and returns an Option func for setting options.metrics
+func WithMetrics(b bool) Option {
+	return func(o *options) {
+		o.metrics = b
+	}
+}
+
+// WithLogger takes a slog.Logger and returns an Option func for setting options.logger
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
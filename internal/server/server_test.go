@@ -1 +1,385 @@
 package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nomasters/hashmap/internal/storage"
+	"github.com/nomasters/hashmap/pkg/payload"
+	"github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "hashmap-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+	for _, f := range []string{cert, key} {
+		if err := ioutil.WriteFile(f, []byte{}, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		options     []Option
+		shouldErr   bool
+		description string
+	}{
+		{
+			description: "defaults should be valid",
+		},
+		{
+			options:     []Option{WithTLS(true), WithCertFile(cert), WithKeyFile(key)},
+			description: "tls with cert and key should be valid",
+		},
+		{
+			options:     []Option{WithTLS(true)},
+			shouldErr:   true,
+			description: "should reject tls without cert",
+		},
+		{
+			options:     []Option{WithTLS(true), WithCertFile(cert)},
+			shouldErr:   true,
+			description: "should reject tls without key",
+		},
+		{
+			options:     []Option{WithTLS(true), WithCertFile(cert), WithKeyFile(filepath.Join(dir, "missing.pem"))},
+			shouldErr:   true,
+			description: "should reject tls with a missing key file",
+		},
+		{
+			options:     []Option{WithPort(70000)},
+			shouldErr:   true,
+			description: "should reject out of range port",
+		},
+		{
+			options:     []Option{WithTimeout(0)},
+			shouldErr:   true,
+			description: "should reject zero timeout",
+		},
+		{
+			options:     []Option{WithThrottle(0)},
+			shouldErr:   true,
+			description: "should reject zero throttle",
+		},
+		{
+			options:     []Option{WithThrottleBacklog(-1)},
+			shouldErr:   true,
+			description: "should reject negative backlog",
+		},
+		{
+			options:     []Option{WithBaseRoute("v1")},
+			shouldErr:   true,
+			description: "should reject relative base route",
+		},
+		{
+			options:     []Option{WithBaseRoute("/v1"), WithTimeout(time.Second)},
+			description: "should allow custom base route",
+		},
+	}
+
+	for _, test := range tests {
+		err := parseOptions(test.options...).validate()
+		if test.shouldErr && err == nil {
+			t.Error(test.description)
+		}
+		if !test.shouldErr && err != nil {
+			t.Error(test.description, err)
+		}
+	}
+}
+
+func TestPayloadHandlers(t *testing.T) {
+	t.Parallel()
+
+	s := storage.NewMemoryStore()
+	defer s.Close()
+	ts := httptest.NewServer(newRouter(s, parseOptions()))
+	defer ts.Close()
+
+	signers := []sig.Signer{sig.GenNaclSign()}
+
+	post := func(p payload.Payload, f payload.Format) int {
+		b, err := payload.MarshalFormat(p, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL, f.ContentType(), bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	get := func(endpoint, accept string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", ts.URL+"/"+endpoint, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp, b
+	}
+
+	p, err := payload.Generate([]byte("hello, json"), signers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := post(p, payload.FormatJSON); code != http.StatusOK {
+		t.Errorf("json post status: %v", code)
+	}
+	p, err = payload.Generate([]byte("hello, protobuf"), signers, payload.WithTimestamp(time.Now().Add(time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := post(p, payload.FormatProtobuf); code != http.StatusOK {
+		t.Errorf("protobuf post status: %v", code)
+	}
+	if code := post(p, payload.FormatProtobuf); code != http.StatusConflict {
+		t.Errorf("replay post status: %v", code)
+	}
+
+	for _, f := range []payload.Format{payload.FormatJSON, payload.FormatProtobuf} {
+		resp, b := get(p.Endpoint(), f.ContentType())
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("get status: %v", resp.StatusCode)
+			continue
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != f.ContentType() {
+			t.Errorf("content-type: %v, expected: %v", ct, f.ContentType())
+		}
+		o, err := payload.UnmarshalFormat(b, f)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(o.Data) != "hello, protobuf" {
+			t.Errorf("data: %s", o.Data)
+		}
+	}
+
+	t.Run("legacy json entry", func(t *testing.T) {
+		p, err := payload.Generate([]byte("legacy"), []sig.Signer{sig.GenNaclSign()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := payload.Marshal(p)
+		if err := s.Set(p.Endpoint(), b, p.TTL, p.Timestamp); err != nil {
+			t.Fatal(err)
+		}
+		if resp, _ := get(p.Endpoint(), ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("get status: %v", resp.StatusCode)
+		}
+	})
+
+	t.Run("threshold policy", func(t *testing.T) {
+		signers := []sig.Signer{sig.GenNaclSign(), sig.GenNaclSign(), sig.GenNaclSign()}
+		keys, err := payload.SignerKeys(signers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy, err := payload.NewPolicy(2, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := payload.Generate([]byte("one of three"), signers[:1], payload.WithPolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := post(p, payload.FormatJSON); code != http.StatusUnprocessableEntity {
+			t.Errorf("below threshold post status: %v", code)
+		}
+		if err := p.Cosign(signers[2:]); err != nil {
+			t.Fatal(err)
+		}
+		if code := post(p, payload.FormatProtobuf); code != http.StatusOK {
+			t.Errorf("threshold post status: %v", code)
+		}
+		if resp, _ := get(policy.Endpoint(), ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("get policy endpoint status: %v", resp.StatusCode)
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		signers := []sig.Signer{sig.GenNaclSign()}
+		now := time.Now()
+		gen := func(d time.Duration, opts ...payload.Option) payload.Payload {
+			p, err := payload.Generate([]byte("chained"), signers, append(opts, payload.WithTimestamp(now.Add(d)))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		}
+		first := gen(0, payload.WithSequence(1))
+		second := gen(time.Millisecond, payload.WithPrevious(first))
+		third := gen(2*time.Millisecond, payload.WithPrevious(second))
+
+		if code := post(first, payload.FormatProtobuf); code != http.StatusOK {
+			t.Errorf("first post status: %v", code)
+		}
+		if code := post(third, payload.FormatProtobuf); code != http.StatusConflict {
+			t.Errorf("skipped sequence post status: %v", code)
+		}
+		if code := post(gen(3*time.Millisecond), payload.FormatProtobuf); code != http.StatusConflict {
+			t.Errorf("unchained post status: %v", code)
+		}
+		if code := post(second, payload.FormatJSON); code != http.StatusOK {
+			t.Errorf("second post status: %v", code)
+		}
+		if code := post(second, payload.FormatJSON); code != http.StatusConflict {
+			t.Errorf("replayed post status: %v", code)
+		}
+		if code := post(third, payload.FormatProtobuf); code != http.StatusOK {
+			t.Errorf("third post status: %v", code)
+		}
+	})
+}
+
+func TestHistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	s := storage.NewMemoryStore(storage.WithMemoryHistory(3))
+	defer s.Close()
+	h := newRouter(s, parseOptions(WithMetrics(true)))
+
+	signers := []sig.Signer{sig.GenNaclSign()}
+	now := time.Now()
+	var endpoint string
+	for i, m := range []string{"one", "two", "three", "four"} {
+		p, err := payload.Generate([]byte(m), signers, payload.WithTimestamp(now.Add(time.Duration(i)*time.Millisecond)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := payload.MarshalProto(p)
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", payload.ContentTypeProtobuf)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("post status: %v", w.Code)
+		}
+		endpoint = p.Endpoint()
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/"+endpoint+"/history", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("history status: %v", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != payload.ContentTypeJSON {
+		t.Errorf("content-type: %v", ct)
+	}
+	var history []payload.Payload
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	var data []string
+	for _, p := range history {
+		data = append(data, string(p.Data))
+	}
+	if expected := "four,three,two"; strings.Join(data, ",") != expected {
+		t.Errorf("actual: %v, expected: %v", data, expected)
+	}
+
+	other, _ := payload.Generate([]byte("other"), []sig.Signer{sig.GenNaclSign()})
+	for path, status := range map[string]int{
+		"/" + other.Endpoint() + "/history": http.StatusNotFound,
+		"/abc/history":                      http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != status {
+			t.Errorf("%v status: %v, expected: %v", path, w.Code, status)
+		}
+	}
+}
+
+// errStore is a storage.GetSetCloser that returns err from Get and Set
+type errStore struct {
+	err error
+}
+
+func (s errStore) Get(string) ([]byte, error)                         { return nil, s.err }
+func (s errStore) Set(string, []byte, time.Duration, time.Time) error { return s.err }
+func (s errStore) Close() error                                       { return nil }
+
+func TestErrorResponses(t *testing.T) {
+	t.Parallel()
+
+	signers := []sig.Signer{sig.GenNaclSign()}
+	valid, err := payload.Generate([]byte("hello"), signers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validBody, _ := payload.MarshalProto(valid)
+	stale, err := payload.Generate([]byte("hello"), signers, payload.WithTimestamp(time.Now().Add(-time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleBody, _ := payload.MarshalProto(stale)
+	endpoint := valid.Endpoint()
+
+	testCases := []struct {
+		name   string
+		store  storage.GetSetCloser
+		method string
+		path   string
+		body   []byte
+		status int
+		code   string
+	}{
+		{"not found", storage.NewMemoryStore(), "GET", "/" + endpoint, nil, http.StatusNotFound, codeNotFound},
+		{"invalid hash", storage.NewMemoryStore(), "GET", "/abc", nil, http.StatusBadRequest, codeBadRequest},
+		{"malformed body", storage.NewMemoryStore(), "POST", "/", []byte{0xff}, http.StatusBadRequest, codeBadRequest},
+		{"too large", storage.NewMemoryStore(), "POST", "/", make([]byte, payload.MaxPayloadSize+1), http.StatusRequestEntityTooLarge, codePayloadTooLarge},
+		{"invalid payload", storage.NewMemoryStore(), "POST", "/", staleBody, http.StatusUnprocessableEntity, codeInvalidPayload},
+		{"stale timestamp", errStore{storage.ErrStaleTimestamp}, "POST", "/", validBody, http.StatusConflict, codeStaleTimestamp},
+		{"conflict", errStore{storage.ErrConflict}, "POST", "/", validBody, http.StatusConflict, codeConflict},
+		{"storage full", errStore{storage.ErrFull}, "POST", "/", validBody, http.StatusServiceUnavailable, codeUnavailable},
+		{"storage unavailable", errStore{fmt.Errorf("%w: dial tcp", storage.ErrUnavailable)}, "GET", "/" + endpoint, nil, http.StatusServiceUnavailable, codeUnavailable},
+		{"storage error", errStore{errors.New("boom")}, "GET", "/" + endpoint, nil, http.StatusInternalServerError, codeInternal},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", payload.ContentTypeProtobuf)
+			w := httptest.NewRecorder()
+			newRouter(tc.store, parseOptions()).ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("status: %v, expected: %v", w.Code, tc.status)
+			}
+			var e errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Code != tc.code {
+				t.Errorf("code: %v, expected: %v", e.Code, tc.code)
+			}
+			if e.Message == "" {
+				t.Error("missing message")
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultDiskPath            = "hashmap.db"
+	defaultDiskCompactInterval = time.Minute
+	diskOpenTimeout            = time.Second
+	diskValHeaderSize          = 16 // timestamp and expires as big endian int64
+)
+
+var diskBucket = []byte("payloads")
+
+// diskOptions specific to DiskStore
+type diskOptions struct {
+	path            string
+	compactInterval time.Duration
+	logger          *slog.Logger
+}
+
+// DiskOption is used for special Settings in Storage
+type DiskOption func(*diskOptions)
+
+// parseDiskOptions takes a arbitrary number of Option funcs and returns a options struct
+func parseDiskOptions(opts ...DiskOption) (o diskOptions) {
+	o = diskOptions{
+		path:            defaultDiskPath,
+		compactInterval: defaultDiskCompactInterval,
+		logger:          slog.Default(),
+	}
+	for _, option := range opts {
+		option(&o)
+	}
+	return
+}
+
+// WithDiskPath takes a string and returns a DiskOption
+func WithDiskPath(p string) DiskOption {
+	return func(o *diskOptions) {
+		if p != "" {
+			o.path = p
+		}
+	}
+}
+
+// WithDiskCompactInterval takes a time.Duration and returns a DiskOption for
+// setting how often expired records are removed from disk.
+func WithDiskCompactInterval(d time.Duration) DiskOption {
+	return func(o *diskOptions) {
+		if d > 0 {
+			o.compactInterval = d
+		}
+	}
+}
+
+// DiskStore is an embedded, file-backed storage engine built on bbolt and is intended
+// for single-node deployments. Entries survive process restarts and expired entries
+// are removed by a background compaction loop. It conforms to the Storage interface.
+type DiskStore struct {
+	db     *bolt.DB
+	logger *slog.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// diskVal is the value stored in the DiskStore bucket. It is encoded as
+// timestamp|expires|payload with both times as big endian unix nanoseconds.
+type diskVal struct {
+	payload   []byte
+	timestamp int64
+	expires   int64
+}
+
+// encode returns the binary encoding of a diskVal
+func (v diskVal) encode() []byte {
+	b := make([]byte, diskValHeaderSize+len(v.payload))
+	binary.BigEndian.PutUint64(b[:8], uint64(v.timestamp))
+	binary.BigEndian.PutUint64(b[8:16], uint64(v.expires))
+	copy(b[diskValHeaderSize:], v.payload)
+	return b
+}
+
+// decodeDiskVal decodes a diskVal, copying the payload out of bbolt owned memory
+func decodeDiskVal(b []byte) (diskVal, error) {
+	if len(b) < diskValHeaderSize {
+		return diskVal{}, errors.New("disk: malformed value")
+	}
+	p := make([]byte, len(b)-diskValHeaderSize)
+	copy(p, b[diskValHeaderSize:])
+	return diskVal{
+		payload:   p,
+		timestamp: int64(binary.BigEndian.Uint64(b[:8])),
+		expires:   int64(binary.BigEndian.Uint64(b[8:16])),
+	}, nil
+}
+
+// expired returns true if the value has expired at reference time t
+func (v diskVal) expired(t time.Time) bool {
+	return v.expires <= t.UnixNano()
+}
+
+// NewDiskStore opens, or creates, the database file and starts the background
+// compaction loop. The file is locked while open, so only one process may use it.
+func NewDiskStore(opts ...DiskOption) (*DiskStore, error) {
+	o := parseDiskOptions(opts...)
+	db, err := bolt.Open(o.path, 0600, &bolt.Options{Timeout: diskOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(diskBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &DiskStore{
+		db:     db,
+		logger: o.logger.With("engine", "disk"),
+		stop:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.compactLoop(o.compactInterval)
+	return s, nil
+}
+
+// Get takes a key string and returns a byte slice and error. Expired entries that
+// have not yet been compacted are treated as not found.
+func (s *DiskStore) Get(key string) ([]byte, error) {
+	var v diskVal
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket).Get([]byte(key))
+		if b == nil {
+			return ErrNotFound
+		}
+		var err error
+		v, err = decodeDiskVal(b)
+		return err
+	})
+	if err != nil {
+		return []byte{}, err
+	}
+	if v.expired(time.Now()) {
+		return []byte{}, ErrNotFound
+	}
+	return v.payload, nil
+}
+
+// Set takes a key string and byte slice value and returns an error. If an unexpired
+// value exists for the key, it checks the timestamp and rejects <= timestamp submissions.
+// The entry expires at safeTTL.
+func (s *DiskStore) Set(key string, value []byte, ttl time.Duration, timestamp time.Time) error {
+	return s.set(key, value, ttl, timestamp, nil)
+}
+
+// CompareAndSet is like Set, but returns ErrConflict if the unexpired value of key is
+// not old. An empty old matches a missing or expired key.
+func (s *DiskStore) CompareAndSet(key string, old, value []byte, ttl time.Duration, timestamp time.Time) error {
+	return s.set(key, value, ttl, timestamp, func(current []byte) error {
+		if !bytes.Equal(current, old) {
+			return ErrConflict
+		}
+		return nil
+	})
+}
+
+// set implements Set. If check is not nil it is called with the unexpired stored
+// value, or nil, in the same transaction, and the value is only written if it
+// returns nil.
+func (s *DiskStore) set(key string, value []byte, ttl time.Duration, timestamp time.Time, check func(current []byte) error) error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(diskBucket)
+		var current *diskVal
+		if b := bkt.Get([]byte(key)); b != nil {
+			v, err := decodeDiskVal(b)
+			if err != nil {
+				return err
+			}
+			if !v.expired(now) {
+				current = &v
+			}
+		}
+		if check != nil {
+			var b []byte
+			if current != nil {
+				b = current.payload
+			}
+			if err := check(b); err != nil {
+				return err
+			}
+		}
+		if current != nil && current.timestamp/1000 >= timestamp.UnixNano()/1000 {
+			return ErrStaleTimestamp
+		}
+		v := diskVal{
+			payload:   value,
+			timestamp: timestamp.UnixNano(),
+			expires:   now.Add(safeTTL(ttl)).UnixNano(),
+		}
+		return bkt.Put([]byte(key), v.encode())
+	})
+}
+
+// Close stops the compaction loop and closes the database file.
+func (s *DiskStore) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+	return s.db.Close()
+}
+
+// compactLoop removes expired entries every interval until the store is closed.
+func (s *DiskStore) compactLoop(interval time.Duration) {
+	defer s.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-t.C:
+			n, err := s.compact(now)
+			if err != nil {
+				s.logger.Error("disk compaction failed", "error", err)
+			} else if n > 0 {
+				s.logger.Info("disk compaction removed expired entries", "removed", n)
+			}
+		}
+	}
+}
+
+// compact deletes all entries that have expired at reference time t and returns
+// the number of deleted entries. Freed pages are reused by bbolt for new writes.
+// Expired keys are collected before they are deleted, because deleting at a cursor
+// can make it skip the next entry.
+func (s *DiskStore) compact(t time.Time) (n int, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(diskBucket)
+		var expired [][]byte
+		c := bucket.Cursor()
+		for k, b := c.First(); k != nil; k, b = c.Next() {
+			v, err := decodeDiskVal(b)
+			if err == nil && !v.expired(t) {
+				continue
+			}
+			expired = append(expired, append([]byte{}, k...))
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, err
+}
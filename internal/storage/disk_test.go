@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDiskStore(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "hashmap-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hashmap.db")
+
+	s, err := NewDiskStore(WithDiskPath(path), WithDiskCompactInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "DEADBEEF"
+	expected := []byte("such_dead_much_beef")
+	now := time.Now()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		if _, err := s.Get(key); err == nil {
+			t.Error("should error on missing key")
+		}
+		if err := s.Set(key, expected, time.Minute, now); err != nil {
+			t.Error(err)
+		}
+		actual, err := s.Get(key)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("actual: %v, expected: %v", actual, expected)
+		}
+		if err := s.Set(key, expected, time.Minute, now); err != ErrStaleTimestamp {
+			t.Errorf("failed to catch equal timestamp: %v", err)
+		}
+		if err := s.Set(key, expected, time.Minute, now.Add(-time.Nanosecond*1000)); err != ErrStaleTimestamp {
+			t.Errorf("failed to catch stale timestamp: %v", err)
+		}
+	})
+
+	t.Run("locked while open", func(t *testing.T) {
+		if _, err := NewDiskStore(WithDiskPath(path)); err == nil {
+			t.Error("failed to catch locked database")
+		}
+	})
+
+	t.Run("survives restart", func(t *testing.T) {
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		s, err = NewDiskStore(WithDiskPath(path), WithDiskCompactInterval(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := s.Get(key)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("actual: %v, expected: %v", actual, expected)
+		}
+		if err := s.Set(key, expected, time.Minute, now); err != ErrStaleTimestamp {
+			t.Errorf("failed to catch replay after restart: %v", err)
+		}
+	})
+
+	t.Run("expiry and compaction", func(t *testing.T) {
+		if err := s.Set("expiring", expected, 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.compact(time.Now()); err != nil || n != 0 {
+			t.Errorf("compacted %v entries early: %v", n, err)
+		}
+		n, err := s.compact(time.Now().Add(safeTTL(0) + time.Second))
+		if err != nil {
+			t.Error(err)
+		}
+		if n != 1 {
+			t.Errorf("compacted: %v, expected: 1", n)
+		}
+		if _, err := s.Get("expiring"); err == nil {
+			t.Error("should not find compacted entry")
+		}
+		if _, err := s.Get(key); err != nil {
+			t.Error("compacted an unexpired entry", err)
+		}
+	})
+
+	t.Run("compaction of adjacent entries", func(t *testing.T) {
+		for _, k := range []string{"adjacent1", "adjacent2", "adjacent3", "adjacent4"} {
+			if err := s.Set(k, expected, 0, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		n, err := s.compact(time.Now().Add(safeTTL(0) + time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 4 {
+			t.Errorf("compacted: %v, expected: 4", n)
+		}
+		if n, err := s.compact(time.Now().Add(safeTTL(0) + time.Second)); err != nil || n != 0 {
+			t.Errorf("expired entries survived compaction: %v, %v", n, err)
+		}
+	})
+
+	t.Run("expired entries are missing before compaction", func(t *testing.T) {
+		v := diskVal{payload: expected, timestamp: now.UnixNano(), expires: now.Add(-time.Second).UnixNano()}
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(diskBucket).Put([]byte("stale"), v.encode())
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get("stale"); err == nil {
+			t.Error("should treat expired entry as not found")
+		}
+		if err := s.Set("stale", expected, time.Minute, now.Add(-time.Hour)); err != nil {
+			t.Error("should allow overwriting an expired entry", err)
+		}
+	})
+
+	t.Run("malformed value", func(t *testing.T) {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(diskBucket).Put([]byte("malformed"), []byte("short"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get("malformed"); err == nil {
+			t.Error("failed to catch malformed value")
+		}
+	})
+
+	t.Run("CompareAndSet", func(t *testing.T) {
+		testCompareAndSet(t, s, "compare")
+	})
+
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+}
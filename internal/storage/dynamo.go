@@ -1,3 +1,270 @@
 package storage
 
-// TODO - add aws dynamodb support
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	defaultDynamoTable   = "hashmap"
+	defaultDynamoTimeout = 5 * time.Second
+)
+
+// dynamoSetCondition only allows a write if no item exists, the stored timestamp is
+// older than the submitted one, or the stored item has expired but not yet been
+// removed by DynamoDB's background TTL process. Timestamps are stored in microseconds
+// to match the precision of the MemoryStore and RedisStore replay checks.
+const dynamoSetCondition = "attribute_not_exists(#k) OR #ts < :ts OR #exp <= :now"
+
+// dynamoCreateCondition only allows a CompareAndSet write with an empty old value if
+// no unexpired item exists
+const dynamoCreateCondition = "attribute_not_exists(#k) OR #exp <= :now"
+
+// dynamoCompareCondition only allows a CompareAndSet write if the unexpired stored
+// item holds the expected payload and an older timestamp
+const dynamoCompareCondition = "#p = :old AND #ts < :ts AND #exp > :now"
+
+// dynamoPlaceholder matches the #name and :value placeholders of an expression
+var dynamoPlaceholder = regexp.MustCompile(`[#:][A-Za-z0-9_]+`)
+
+// dynamoAPI is the subset of the DynamoDB client used by DynamoStore
+type dynamoAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// dynamoOptions specific to DynamoStore
+type dynamoOptions struct {
+	table    string
+	region   string
+	endpoint string
+	timeout  time.Duration
+	logger   *slog.Logger
+}
+
+// DynamoOption is used for special Settings in Storage
+type DynamoOption func(*dynamoOptions)
+
+// parseDynamoOptions takes a arbitrary number of Option funcs and returns a options struct
+func parseDynamoOptions(opts ...DynamoOption) (o dynamoOptions) {
+	o = dynamoOptions{
+		table:   defaultDynamoTable,
+		timeout: defaultDynamoTimeout,
+		logger:  slog.Default(),
+	}
+	for _, option := range opts {
+		option(&o)
+	}
+	return
+}
+
+// WithDynamoTable takes a string and returns a DynamoOption
+func WithDynamoTable(t string) DynamoOption {
+	return func(o *dynamoOptions) {
+		if t != "" {
+			o.table = t
+		}
+	}
+}
+
+// WithDynamoRegion takes a string and returns a DynamoOption
+func WithDynamoRegion(r string) DynamoOption {
+	return func(o *dynamoOptions) {
+		o.region = r
+	}
+}
+
+// WithDynamoEndpoint takes a string and returns a DynamoOption. This is used to
+// point the client at a local DynamoDB, such as dynamodb-local.
+func WithDynamoEndpoint(e string) DynamoOption {
+	return func(o *dynamoOptions) {
+		o.endpoint = e
+	}
+}
+
+// WithDynamoTimeout takes a time.Duration and returns a DynamoOption
+func WithDynamoTimeout(d time.Duration) DynamoOption {
+	return func(o *dynamoOptions) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// DynamoStore is a struct with methods that conforms to the Storage Interface. It
+// expects a table with a string partition key named "key" and DynamoDB TTL enabled
+// on the numeric "expires" attribute.
+type DynamoStore struct {
+	client  dynamoAPI
+	table   string
+	timeout time.Duration
+	logger  *slog.Logger
+}
+
+// NewDynamoStore returns a DynamoStore using the default AWS credential chain. Region
+// and endpoint are taken from the DynamoOptions when set.
+func NewDynamoStore(opts ...DynamoOption) (*DynamoStore, error) {
+	o := parseDynamoOptions(opts...)
+	var loadOpts []func(*config.LoadOptions) error
+	if o.region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(o.region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), loadOpts...)
+	if err != nil {
+		return nil, err
+	}
+	client := dynamodb.NewFromConfig(cfg, func(d *dynamodb.Options) {
+		if o.endpoint != "" {
+			d.BaseEndpoint = aws.String(o.endpoint)
+		}
+	})
+	return newDynamoStore(client, o), nil
+}
+
+// newDynamoStore returns a DynamoStore for a dynamoAPI client
+func newDynamoStore(client dynamoAPI, o dynamoOptions) *DynamoStore {
+	return &DynamoStore{
+		client:  client,
+		table:   o.table,
+		timeout: o.timeout,
+		logger:  o.logger.With("engine", "dynamo"),
+	}
+}
+
+// Get method for DynamoStore. It uses a strongly consistent read and treats items
+// that have expired, but have not yet been removed by DynamoDB, as not found.
+func (s *DynamoStore) Get(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return []byte{}, unavailable(s.logger, err)
+	}
+	if out.Item == nil {
+		return []byte{}, ErrNotFound
+	}
+	expires, err := dynamoNumber(out.Item["expires"])
+	if err != nil {
+		return []byte{}, err
+	}
+	if expires <= time.Now().Unix() {
+		return []byte{}, ErrNotFound
+	}
+	payload, ok := out.Item["payload"].(*types.AttributeValueMemberB)
+	if !ok {
+		return []byte{}, errors.New("dynamo: malformed payload attribute")
+	}
+	return payload.Value, nil
+}
+
+// Set method takes a key, value, and options and writes the value to DynamoDB with a
+// conditional expression that rejects timestamps less than or equal to the stored
+// timestamp. The expires attribute is set using safeTTL for DynamoDB native TTL expiry.
+func (s *DynamoStore) Set(key string, value []byte, ttl time.Duration, timestamp time.Time) error {
+	err := s.put(key, value, ttl, timestamp, dynamoSetCondition, nil)
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return ErrStaleTimestamp
+	}
+	return err
+}
+
+// CompareAndSet is like Set, but only writes if the unexpired stored payload is old,
+// or if there is none when old is empty. DynamoDB does not report which condition
+// failed, so a stale timestamp is also returned as ErrConflict.
+func (s *DynamoStore) CompareAndSet(key string, old, value []byte, ttl time.Duration, timestamp time.Time) error {
+	condition, values := dynamoCreateCondition, map[string]types.AttributeValue(nil)
+	if len(old) > 0 {
+		condition = dynamoCompareCondition
+		values = map[string]types.AttributeValue{":old": &types.AttributeValueMemberB{Value: old}}
+	}
+	err := s.put(key, value, ttl, timestamp, condition, values)
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return ErrConflict
+	}
+	return err
+}
+
+// put writes an item with a condition expression. The #k, #p, #ts and #exp names and
+// the :ts and :now values are available to every condition, and values adds more.
+// Only the placeholders used by the condition are sent, because DynamoDB rejects
+// unused expression attributes. A failed condition is returned as a
+// types.ConditionalCheckFailedException.
+func (s *DynamoStore) put(key string, value []byte, ttl time.Duration, timestamp time.Time, condition string, values map[string]types.AttributeValue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	now := time.Now()
+	names := map[string]string{
+		"#k":   "key",
+		"#p":   "payload",
+		"#ts":  "timestamp",
+		"#exp": "expires",
+	}
+	available := map[string]types.AttributeValue{
+		":ts":  dynamoNumberValue(timestamp.UnixNano() / 1000),
+		":now": dynamoNumberValue(now.Unix()),
+	}
+	for k, v := range values {
+		available[k] = v
+	}
+	in := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"key":       &types.AttributeValueMemberS{Value: key},
+			"payload":   &types.AttributeValueMemberB{Value: value},
+			"timestamp": dynamoNumberValue(timestamp.UnixNano() / 1000),
+			"expires":   dynamoNumberValue(now.Add(safeTTL(ttl)).Unix()),
+		},
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  make(map[string]string),
+		ExpressionAttributeValues: make(map[string]types.AttributeValue),
+	}
+	for _, p := range dynamoPlaceholder.FindAllString(condition, -1) {
+		if n, ok := names[p]; ok {
+			in.ExpressionAttributeNames[p] = n
+		}
+		if v, ok := available[p]; ok {
+			in.ExpressionAttributeValues[p] = v
+		}
+	}
+	_, err := s.client.PutItem(ctx, in)
+	var ccf *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &ccf) {
+		return unavailable(s.logger, err)
+	}
+	return err
+}
+
+// Close implements the standard Close method for storage. The DynamoDB client
+// holds no resources that need to be released.
+func (s *DynamoStore) Close() error {
+	return nil
+}
+
+// dynamoNumberValue returns an int64 as a DynamoDB number attribute
+func dynamoNumberValue(i int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(i, 10)}
+}
+
+// dynamoNumber parses a DynamoDB number attribute into an int64
+func dynamoNumber(v types.AttributeValue) (int64, error) {
+	n, ok := v.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, errors.New("dynamo: malformed number attribute")
+	}
+	return strconv.ParseInt(n.Value, 10, 64)
+}
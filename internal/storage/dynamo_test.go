@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamo is an in-process stand-in for the GetItem and PutItem calls of DynamoDB.
+// It evaluates the condition expressions of DynamoStore against the stored item the
+// way DynamoDB would.
+type fakeDynamo struct {
+	sync.Mutex
+	items map[string]map[string]types.AttributeValue
+	err   error
+}
+
+func newFakeDynamo() *fakeDynamo {
+	return &fakeDynamo{items: make(map[string]map[string]types.AttributeValue)}
+}
+
+func (f *fakeDynamo) GetItem(ctx context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	k := in.Key["key"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: f.items[aws.ToString(in.TableName)+"/"+k]}, nil
+}
+
+func (f *fakeDynamo) PutItem(ctx context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if err := validateExpression(in); err != nil {
+		return nil, err
+	}
+	k := aws.ToString(in.TableName) + "/" + in.Item["key"].(*types.AttributeValueMemberS).Value
+	existing, ok := f.items[k]
+	ts, _ := dynamoNumber(existing["timestamp"])
+	exp, _ := dynamoNumber(existing["expires"])
+	newTS, _ := dynamoNumber(in.ExpressionAttributeValues[":ts"])
+	now, _ := dynamoNumber(in.ExpressionAttributeValues[":now"])
+	var pass bool
+	switch aws.ToString(in.ConditionExpression) {
+	case dynamoSetCondition:
+		pass = !ok || ts < newTS || exp <= now
+	case dynamoCreateCondition:
+		pass = !ok || exp <= now
+	case dynamoCompareCondition:
+		p, _ := existing["payload"].(*types.AttributeValueMemberB)
+		old := in.ExpressionAttributeValues[":old"].(*types.AttributeValueMemberB)
+		pass = ok && p != nil && bytes.Equal(p.Value, old.Value) && ts < newTS && exp > now
+	default:
+		return nil, errors.New("fakeDynamo: unsupported condition expression")
+	}
+	if !pass {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("conditional check failed")}
+	}
+	f.items[k] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// validateExpression returns an error, like the ValidationException of DynamoDB, if
+// the condition expression of in uses an undefined placeholder or if in defines a
+// placeholder the condition does not use
+func validateExpression(in *dynamodb.PutItemInput) error {
+	used := make(map[string]bool)
+	for _, p := range dynamoPlaceholder.FindAllString(aws.ToString(in.ConditionExpression), -1) {
+		_, name := in.ExpressionAttributeNames[p]
+		_, value := in.ExpressionAttributeValues[p]
+		if !name && !value {
+			return fmt.Errorf("fakeDynamo: undefined expression attribute: %v", p)
+		}
+		used[p] = true
+	}
+	for p := range in.ExpressionAttributeNames {
+		if !used[p] {
+			return fmt.Errorf("fakeDynamo: unused expression attribute name: %v", p)
+		}
+	}
+	for p := range in.ExpressionAttributeValues {
+		if !used[p] {
+			return fmt.Errorf("fakeDynamo: unused expression attribute value: %v", p)
+		}
+	}
+	return nil
+}
+
+func TestDynamoStore(t *testing.T) {
+	t.Parallel()
+
+	f := newFakeDynamo()
+	s := newDynamoStore(f, parseDynamoOptions(WithDynamoTable("test"), WithDynamoTimeout(time.Second)))
+	defer s.Close()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		key := "DEADBEEF"
+		expected := []byte("such_dead_much_beef")
+		now := time.Now()
+
+		if _, err := s.Get(key); err == nil {
+			t.Error("should error on missing key")
+		}
+		if err := s.Set(key, expected, time.Minute, now); err != nil {
+			t.Error(err)
+		}
+		actual, err := s.Get(key)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("actual: %v, expected: %v", actual, expected)
+		}
+		if err := s.Set(key, expected, time.Minute, now); err != ErrStaleTimestamp {
+			t.Errorf("failed to catch equal timestamp: %v", err)
+		}
+		if err := s.Set(key, expected, time.Minute, now.Add(-time.Millisecond)); err != ErrStaleTimestamp {
+			t.Errorf("failed to catch stale timestamp: %v", err)
+		}
+		if err := s.Set(key, []byte("newer"), time.Minute, now.Add(time.Millisecond)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("safeTTL expiry", func(t *testing.T) {
+		key := "ttl"
+		before := time.Now()
+		if err := s.Set(key, []byte("ttl"), 0, before); err != nil {
+			t.Fatal(err)
+		}
+		expires, err := dynamoNumber(f.items["test/"+key]["expires"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := before.Add(minTTL).Unix(); expires < expected || expires > expected+1 {
+			t.Errorf("actual: %v, expected: %v", expires, expected)
+		}
+	})
+
+	t.Run("expired but not yet removed", func(t *testing.T) {
+		key := "expired"
+		now := time.Now()
+		if err := s.Set(key, []byte("old"), time.Minute, now); err != nil {
+			t.Fatal(err)
+		}
+		f.Lock()
+		f.items["test/"+key]["expires"] = dynamoNumberValue(now.Add(-time.Second).Unix())
+		f.Unlock()
+		if _, err := s.Get(key); err == nil {
+			t.Error("should treat expired item as not found")
+		}
+		if err := s.Set(key, []byte("replacement"), time.Minute, now.Add(-time.Second)); err != nil {
+			t.Error("should allow overwriting an expired item", err)
+		}
+	})
+
+	t.Run("malformed item", func(t *testing.T) {
+		f.Lock()
+		f.items["test/malformed"] = map[string]types.AttributeValue{
+			"key":     &types.AttributeValueMemberS{Value: "malformed"},
+			"payload": &types.AttributeValueMemberS{Value: "not bytes"},
+			"expires": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+		}
+		f.items["test/noexpiry"] = map[string]types.AttributeValue{
+			"key": &types.AttributeValueMemberS{Value: "noexpiry"},
+		}
+		f.Unlock()
+		if _, err := s.Get("malformed"); err == nil {
+			t.Error("failed to catch malformed payload")
+		}
+		if _, err := s.Get("noexpiry"); err == nil {
+			t.Error("failed to catch missing expires")
+		}
+	})
+
+	t.Run("CompareAndSet", func(t *testing.T) {
+		testCompareAndSet(t, s, "compare")
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		f := newFakeDynamo()
+		f.err = errors.New("connection refused")
+		s := newDynamoStore(f, parseDynamoOptions())
+		if _, err := s.Get("err"); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("expected ErrUnavailable, got: %v", err)
+		}
+		if err := s.Set("err", []byte{}, 0, time.Now()); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("expected ErrUnavailable, got: %v", err)
+		}
+	})
+}
@@ -2,79 +2,381 @@ package storage
 
 import (
 	"bytes"
-	"errors"
+	"container/heap"
+	"log/slog"
 	"sync"
 	"time"
 )
 
+// EvictionPolicy is the enum type for how a bounded MemoryStore makes room for new entries
+type EvictionPolicy uint8
+
+// Enum types for EvictionPolicy
+const (
+	// RejectWhenFull rejects new entries with ErrFull until space is freed by expiry.
+	// It is the default, because it never removes the replay protection of a live key.
+	RejectWhenFull EvictionPolicy = iota
+	// EvictExpiringFirst removes the entries closest to expiry until the new entry fits.
+	// An evicted key loses its replay protection, so a flood of new endpoints can allow
+	// the replay of an older payload for an evicted key. Bounds should be sized for the
+	// expected working set.
+	EvictExpiringFirst
+)
+
+// memoryOptions specific to MemoryStore
+type memoryOptions struct {
+	maxEntries int
+	maxBytes   int
+	policy     EvictionPolicy
+	history    int
+	logger     *slog.Logger
+}
+
+// MemoryOption is used for special Settings in Storage
+type MemoryOption func(*memoryOptions)
+
+// parseMemoryOptions takes a arbitrary number of Option funcs and returns a options struct
+func parseMemoryOptions(opts ...MemoryOption) (o memoryOptions) {
+	o = memoryOptions{
+		logger: slog.Default(),
+	}
+	for _, option := range opts {
+		option(&o)
+	}
+	return
+}
+
+// WithMemoryMaxEntries takes an int and returns a MemoryOption. 0 is unbounded.
+func WithMemoryMaxEntries(n int) MemoryOption {
+	return func(o *memoryOptions) {
+		o.maxEntries = n
+	}
+}
+
+// WithMemoryMaxBytes takes an int and returns a MemoryOption for bounding the total
+// size of keys and payloads held in memory. 0 is unbounded.
+func WithMemoryMaxBytes(n int) MemoryOption {
+	return func(o *memoryOptions) {
+		o.maxBytes = n
+	}
+}
+
+// WithMemoryEvictionPolicy takes an EvictionPolicy and returns a MemoryOption
+func WithMemoryEvictionPolicy(p EvictionPolicy) MemoryOption {
+	return func(o *memoryOptions) {
+		o.policy = p
+	}
+}
+
+// WithMemoryHistory takes an int and returns a MemoryOption for keeping the last n
+// values of each key, including the current value, for List. Each value expires with
+// its own ttl. 0 or 1 keeps only the current value.
+func WithMemoryHistory(n int) MemoryOption {
+	return func(o *memoryOptions) {
+		o.history = n
+	}
+}
+
 // MemoryStore is the primary in-memory data storage and retrieval struct. It contains
 // a sync.RWMutex and an internal map of `map[string][]byte` to store state that conforms
-// to the Storage interface.
+// to the Storage interface. Expiry is handled by a single scheduler goroutine driven by
+// a min-heap of expiry times, which is stopped by Close.
 type MemoryStore struct {
 	sync.RWMutex
 	internal map[string]memVal
+	expiry   expiryHeap
+	bytes    int
+	options  memoryOptions
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
 }
 
 // memVal is the value wrapper in the MemoryStore internal map and is used to
-// store the timestamp of the payload to prevent replay attacks
+// store the timestamp of the payload to prevent replay attacks. history holds the
+// previous values of the key, newest first, when history is enabled.
 type memVal struct {
 	payload   []byte
 	timestamp time.Time
+	expires   time.Time
+	history   []memVal
+}
+
+// expired returns true if the value has an expiry at or before reference time t
+func (v memVal) expired(t time.Time) bool {
+	return !v.expires.IsZero() && !t.Before(v.expires)
+}
+
+// size returns the bytes held for key by the value and its history
+func (v memVal) size(key string) int {
+	n := len(key) + len(v.payload)
+	for _, h := range v.history {
+		n += len(h.payload)
+	}
+	return n
+}
+
+// lastExpiry returns the latest expiry of the value and its history, after which
+// the key can be removed
+func (v memVal) lastExpiry() time.Time {
+	t := v.expires
+	for _, h := range v.history {
+		if h.expires.After(t) {
+			t = h.expires
+		}
+	}
+	return t
+}
+
+// retain returns the unexpired values of v and its history at reference time t,
+// newest first and at most n, to be kept as the history of the value replacing v
+func (v memVal) retain(t time.Time, n int) []memVal {
+	var o []memVal
+	for _, h := range append([]memVal{v}, v.history...) {
+		if len(o) == n {
+			break
+		}
+		if !h.expired(t) {
+			h.history = nil
+			o = append(o, h)
+		}
+	}
+	return o
 }
 
 // NewMemoryStore returns a reference to a MemoryStore with an initialized internal map
-func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
+// and a running expiry scheduler.
+func NewMemoryStore(opts ...MemoryOption) *MemoryStore {
+	s := &MemoryStore{
 		internal: make(map[string]memVal),
+		expiry:   expiryHeap{index: make(map[string]int)},
+		options:  parseMemoryOptions(opts...),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
 	}
+	go s.schedule()
+	return s
 }
 
 // Get takes a key string and returns a byte slice and error. This method uses read locks.
-// It returns an error if the key is not found.
+// It returns an error if the key is not found or has expired.
 func (s *MemoryStore) Get(key string) ([]byte, error) {
 	s.RLock()
 	v, ok := s.internal[key]
 	s.RUnlock()
-	if !ok {
-		return []byte{}, errors.New("key not found")
+	if !ok || v.expired(time.Now()) {
+		return []byte{}, ErrNotFound
 	}
 	return v.payload, nil
 }
 
+// List takes a key string and returns the unexpired values of the key, newest first.
+// Unless history is enabled with WithMemoryHistory, that is at most the current value.
+// It returns ErrNotFound if there are none.
+func (s *MemoryStore) List(key string) ([][]byte, error) {
+	now := time.Now()
+	s.RLock()
+	v, ok := s.internal[key]
+	s.RUnlock()
+	var values [][]byte
+	if ok {
+		for _, h := range append([]memVal{v}, v.history...) {
+			if !h.expired(now) {
+				values = append(values, h.payload)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+	return values, nil
+}
+
 // Set takes a key string and byte slice value and returns an error. It uses a mutex write lock for safety.
 // If an existing key value pair exists, it checks the timestamp and rejects <= timestamp submissions.
+// If the store is bounded and full, room is made according to the EvictionPolicy.
 func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration, timestamp time.Time) error {
 	s.Lock()
+	defer s.Unlock()
+	return s.set(time.Now(), key, value, ttl, timestamp)
+}
+
+// CompareAndSet is like Set, but returns ErrConflict if the unexpired value of key is
+// not old. An empty old matches a missing or expired key.
+func (s *MemoryStore) CompareAndSet(key string, old, value []byte, ttl time.Duration, timestamp time.Time) error {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	var current []byte
+	if v, ok := s.internal[key]; ok && !v.expired(now) {
+		current = v.payload
+	}
+	if !bytes.Equal(current, old) {
+		return ErrConflict
+	}
+	return s.set(now, key, value, ttl, timestamp)
+}
 
+// set implements Set at reference time now. Callers must hold the lock.
+func (s *MemoryStore) set(now time.Time, key string, value []byte, ttl time.Duration, timestamp time.Time) error {
 	v, ok := s.internal[key]
-	if ok {
+	if ok && !v.expired(now) {
 		if v.timestamp.UnixNano()/1000 >= timestamp.UnixNano()/1000 {
-			s.Unlock()
-			return errInvalidTimestamp
+			return ErrStaleTimestamp
 		}
 	}
-	s.internal[key] = memVal{
+	nv := memVal{
 		payload:   value,
 		timestamp: timestamp,
+		expires:   now.Add(safeTTL(ttl)),
+	}
+	if ok && s.options.history > 1 {
+		nv.history = v.retain(now, s.options.history-1)
+	}
+	size := nv.size(key)
+	if s.options.maxBytes > 0 && size > s.options.maxBytes {
+		s.options.logger.Warn("memory store rejected entry larger than max bytes", "key", key, "size", size)
+		return ErrFull
+	}
+	if ok {
+		s.remove(key)
+	}
+	for s.full(size) {
+		if s.options.policy == RejectWhenFull || s.expiry.Len() == 0 {
+			if ok {
+				s.insert(key, v)
+			}
+			s.options.logger.Warn("memory store full", "entries", len(s.internal), "bytes", s.bytes)
+			return ErrFull
+		}
+		evicted := s.expiry.entries[0].key
+		s.remove(evicted)
+		s.options.logger.Warn("memory store evicted entry", "key", evicted)
+	}
+	s.insert(key, nv)
+	if s.expiry.entries[0].key == key {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
 	}
-	s.Unlock()
-	go func() {
-		time.Sleep(safeTTL(ttl))
-		s.deleteIfValueMatch(key, value)
-	}()
 	return nil
 }
 
-// Close implements the standard Close method for storage.
+// Close stops the expiry scheduler. It is safe to call more than once.
 func (s *MemoryStore) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
 	return nil
 }
 
-// deleteIfValueMatch compares values and deletes if they are they same
-func (s *MemoryStore) deleteIfValueMatch(key string, value []byte) {
+// Len returns the number of entries and total bytes of keys and payloads held in memory.
+func (s *MemoryStore) Len() (entries int, bytes int) {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.internal), s.bytes
+}
+
+// full returns true if adding an entry of size bytes would exceed the configured bounds.
+// Callers must hold the lock.
+func (s *MemoryStore) full(size int) bool {
+	if s.options.maxEntries > 0 && len(s.internal)+1 > s.options.maxEntries {
+		return true
+	}
+	return s.options.maxBytes > 0 && s.bytes+size > s.options.maxBytes
+}
+
+// insert adds a value to the map and expiry heap. Callers must hold the lock.
+func (s *MemoryStore) insert(key string, v memVal) {
+	s.internal[key] = v
+	s.bytes += v.size(key)
+	heap.Push(&s.expiry, expiryEntry{key: key, expires: v.lastExpiry()})
+}
+
+// remove deletes a key from the map and expiry heap. Callers must hold the lock.
+func (s *MemoryStore) remove(key string) {
+	v, ok := s.internal[key]
+	if !ok {
+		return
+	}
+	delete(s.internal, key)
+	s.bytes -= v.size(key)
+	if i, ok := s.expiry.index[key]; ok {
+		heap.Remove(&s.expiry, i)
+	}
+}
+
+// expire removes all entries that have expired at reference time t and returns
+// the time of the next expiry, or the zero time if the store is empty.
+func (s *MemoryStore) expire(t time.Time) time.Time {
 	s.Lock()
-	if bytes.Equal(s.internal[key].payload, value) {
-		delete(s.internal, key)
+	defer s.Unlock()
+	for s.expiry.Len() > 0 {
+		next := s.expiry.entries[0]
+		if t.Before(next.expires) {
+			return next.expires
+		}
+		s.remove(next.key)
+	}
+	return time.Time{}
+}
+
+// schedule runs the expiry loop. It sleeps until the earliest expiry, or until
+// woken by a Set that changes the earliest expiry, and exits when the store is closed.
+func (s *MemoryStore) schedule() {
+	defer close(s.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+		if next := s.expire(time.Now()); !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
 	}
-	s.Unlock()
+}
+
+// expiryEntry is an element of the expiryHeap
+type expiryEntry struct {
+	key     string
+	expires time.Time
+}
+
+// expiryHeap is a min-heap of expiry times implementing heap.Interface. It tracks
+// the position of each key so entries can be removed when a key is overwritten.
+type expiryHeap struct {
+	entries []expiryEntry
+	index   map[string]int
+}
+
+func (h expiryHeap) Len() int           { return len(h.entries) }
+func (h expiryHeap) Less(i, j int) bool { return h.entries[i].expires.Before(h.entries[j].expires) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].key] = i
+	h.index[h.entries[j].key] = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(expiryEntry)
+	h.index[e.key] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	n := len(h.entries) - 1
+	e := h.entries[n]
+	h.entries = h.entries[:n]
+	delete(h.index, e.key)
+	return e
 }
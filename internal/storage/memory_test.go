@@ -2,6 +2,9 @@ package storage
 
 import (
 	"bytes"
+	"container/heap"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
 )
@@ -35,8 +38,8 @@ func TestMemoryStore_Get(t *testing.T) {
 
 		key := "DEADBEEF"
 		s := NewMemoryStore()
-		if _, err := s.Get(key); err == nil {
-			t.Fail()
+		if _, err := s.Get(key); err != ErrNotFound {
+			t.Errorf("expected ErrNotFound, got: %v", err)
 		}
 	})
 }
@@ -71,23 +74,258 @@ func TestMemoryStore_Set(t *testing.T) {
 		}
 	})
 
-	t.Run("deleteIfValueMatch", func(t *testing.T) {
+	t.Run("expire", func(t *testing.T) {
 		t.Parallel()
 
 		key := "DEADBEEF"
 		expected := []byte("such_dead_much_beef")
 		s := NewMemoryStore()
-
-		if _, err := s.Get(key); err == nil {
-			t.Fail()
-		}
+		defer s.Close()
 
 		if err := s.Set(key, expected, 1*time.Second, time.Now()); err != nil {
 			t.Error(err)
 		}
-		s.deleteIfValueMatch(key, expected)
+		if next := s.expire(time.Now()); next.IsZero() {
+			t.Error("expected a pending expiry")
+		}
+		if _, err := s.Get(key); err != nil {
+			t.Error("expired key too early")
+		}
+		if next := s.expire(time.Now().Add(safeTTL(time.Second))); !next.IsZero() {
+			t.Error("expected no pending expiry")
+		}
 		if _, err := s.Get(key); err == nil {
 			t.Error("failed to delete key")
 		}
+		if entries, bytes := s.Len(); entries != 0 || bytes != 0 {
+			t.Errorf("entries: %v, bytes: %v, expected empty", entries, bytes)
+		}
+	})
+
+	t.Run("expired before sweep", func(t *testing.T) {
+		t.Parallel()
+
+		key := "DEADBEEF"
+		now := time.Now()
+		s := NewMemoryStore()
+		defer s.Close()
+
+		s.Lock()
+		s.internal[key] = memVal{
+			payload:   []byte("stale"),
+			timestamp: now,
+			expires:   now.Add(-time.Second),
+		}
+		s.Unlock()
+		if _, err := s.Get(key); err == nil {
+			t.Error("should treat expired entry as not found")
+		}
+		if err := s.Set(key, []byte("fresh"), time.Second, now.Add(-time.Hour)); err != nil {
+			t.Error("should allow overwriting an expired entry", err)
+		}
+	})
+
+	t.Run("overwrite keeps one expiry per key", func(t *testing.T) {
+		t.Parallel()
+
+		key := "DEADBEEF"
+		now := time.Now()
+		s := NewMemoryStore()
+		defer s.Close()
+
+		for i := 0; i < 10; i++ {
+			if err := s.Set(key, []byte("such_dead_much_beef"), time.Minute, now.Add(time.Duration(i)*time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s.expiry.Len() != 1 {
+			t.Errorf("expiry entries: %v, expected: 1", s.expiry.Len())
+		}
+		if entries, bytes := s.Len(); entries != 1 || bytes != len(key)+len("such_dead_much_beef") {
+			t.Errorf("entries: %v, bytes: %v", entries, bytes)
+		}
+	})
+
+	t.Run("scheduler", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewMemoryStore()
+		if err := s.Set("DEADBEEF", []byte("such_dead_much_beef"), 0, time.Now()); err != nil {
+			t.Error(err)
+		}
+		s.Lock()
+		i := s.expiry.index["DEADBEEF"]
+		s.expiry.entries[i].expires = time.Now()
+		heap.Fix(&s.expiry, i)
+		s.Unlock()
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+		deadline := time.Now().Add(time.Second)
+		for {
+			if entries, _ := s.Len(); entries == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("scheduler failed to expire entry")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestMemoryStore_Bounds(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	value := []byte("such_dead_much_beef")
+
+	t.Run("max entries evicts soonest expiry", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewMemoryStore(WithMemoryMaxEntries(2), WithMemoryEvictionPolicy(EvictExpiringFirst))
+		defer s.Close()
+		s.Set("a", value, time.Hour, now)
+		s.Set("b", value, 2*time.Hour, now)
+		if err := s.Set("c", value, 3*time.Hour, now); err != nil {
+			t.Error(err)
+		}
+		if _, err := s.Get("a"); err == nil {
+			t.Error("failed to evict soonest expiry")
+		}
+		for _, k := range []string{"b", "c"} {
+			if _, err := s.Get(k); err != nil {
+				t.Errorf("evicted %v", k)
+			}
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewMemoryStore(WithMemoryMaxBytes(2*(1+len(value))), WithMemoryEvictionPolicy(EvictExpiringFirst))
+		defer s.Close()
+		s.Set("a", value, time.Hour, now)
+		s.Set("b", value, 2*time.Hour, now)
+		if err := s.Set("c", value, 3*time.Hour, now); err != nil {
+			t.Error(err)
+		}
+		if entries, bytes := s.Len(); entries != 2 || bytes != 2*(1+len(value)) {
+			t.Errorf("entries: %v, bytes: %v", entries, bytes)
+		}
+		if err := s.Set("d", make([]byte, 100), time.Hour, now); err != ErrFull {
+			t.Errorf("failed to reject oversized entry: %v", err)
+		}
+	})
+
+	t.Run("reject when full by default", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewMemoryStore(WithMemoryMaxEntries(1))
+		defer s.Close()
+		if err := s.Set("a", value, time.Hour, now); err != nil {
+			t.Error(err)
+		}
+		if err := s.Set("b", value, time.Hour, now); err != ErrFull {
+			t.Errorf("failed to reject when full: %v", err)
+		}
+		if err := s.Set("a", []byte("update"), time.Hour, now.Add(time.Second)); err != nil {
+			t.Error("should allow updating an existing key when full", err)
+		}
+		if actual, _ := s.Get("a"); !bytes.Equal(actual, []byte("update")) {
+			t.Errorf("actual: %s, expected: update", actual)
+		}
+	})
+
+	t.Run("eviction is logged", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		s, err := New(
+			WithEngine(MemoryEngine),
+			WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+			WithMemoryOptions(WithMemoryMaxEntries(1), WithMemoryEvictionPolicy(EvictExpiringFirst)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		s.Set("a", value, time.Hour, now)
+		s.Set("b", value, time.Hour, now)
+		if !strings.Contains(buf.String(), `msg="memory store evicted entry" key=a`) {
+			t.Errorf("unexpected log: %s", buf.String())
+		}
+	})
+}
+
+func TestMemoryStore_CompareAndSet(t *testing.T) {
+	t.Parallel()
+
+	s := NewMemoryStore()
+	defer s.Close()
+	testCompareAndSet(t, s, "compare")
+}
+
+func TestMemoryStore_List(t *testing.T) {
+	t.Parallel()
+
+	t.Run("history", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewMemoryStore(WithMemoryHistory(3))
+		defer s.Close()
+		testHistory(t, s, "history")
+		if entries, bytes := s.Len(); entries != 1 || bytes != len("history")+len("fourthreetwo") {
+			t.Errorf("entries: %v, bytes: %v", entries, bytes)
+		}
+	})
+
+	t.Run("expired values", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewMemoryStore(WithMemoryHistory(3))
+		defer s.Close()
+		now := time.Now()
+		s.Set("k", []byte("long"), time.Hour, now)
+		s.Set("k", []byte("short"), time.Minute, now.Add(time.Millisecond))
+		s.Lock()
+		v := s.internal["k"]
+		v.expires = now.Add(-time.Second)
+		s.internal["k"] = v
+		s.Unlock()
+		if _, err := s.Get("k"); err != ErrNotFound {
+			t.Errorf("failed to expire current value: %v", err)
+		}
+		values, err := s.List("k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != 1 || string(values[0]) != "long" {
+			t.Errorf("unexpected history: %q", values)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		s := NewMemoryStore()
+		defer s.Close()
+		now := time.Now()
+		s.Set("k", []byte("one"), time.Minute, now)
+		s.Set("k", []byte("two"), time.Minute, now.Add(time.Millisecond))
+		values, err := s.List("k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != 1 || string(values[0]) != "two" {
+			t.Errorf("unexpected history: %q", values)
+		}
 	})
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"encoding/base64"
 	"encoding/json"
+	"log/slog"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -23,6 +24,8 @@ type redisOptions struct {
 	maxConnLifetime   time.Duration
 	tls               bool
 	dialTLSSkipVerify bool
+	history           int
+	logger            *slog.Logger
 }
 
 // RedisOption is used for special Settings in Storage
@@ -30,6 +33,9 @@ type RedisOption func(*redisOptions)
 
 // parseRedisOptions takes a arbitrary number of Option funcs and returns a options struct
 func parseRedisOptions(opts ...RedisOption) (o redisOptions) {
+	o = redisOptions{
+		logger: slog.Default(),
+	}
 	for _, option := range opts {
 		option(&o)
 	}
@@ -99,9 +105,20 @@ func WithRedisDialTLSSkipVerify(b bool) RedisOption {
 	}
 }
 
+// WithRedisHistory takes an int and returns an RedisOption for keeping the last n
+// values of each key, including the current value, for List. Each value expires with
+// its own ttl. 0 or 1 keeps only the current value.
+func WithRedisHistory(n int) RedisOption {
+	return func(o *redisOptions) {
+		o.history = n
+	}
+}
+
 // RedisStore is a struct with methods that conforms to the Storage Interface
 type RedisStore struct {
-	pool *redis.Pool
+	pool    *redis.Pool
+	history int
+	logger  *slog.Logger
 }
 
 // NewRedisStore returns a RedisStore with StorageOptions mapped to Redis Pool settings.
@@ -113,6 +130,8 @@ func NewRedisStore(opts ...RedisOption) *RedisStore {
 	}
 
 	return &RedisStore{
+		history: o.history,
+		logger:  o.logger.With("engine", "redis"),
 		pool: &redis.Pool{
 			MaxIdle:         o.maxIdle,
 			MaxActive:       o.maxActive,
@@ -136,10 +155,45 @@ func NewRedisStore(opts ...RedisOption) *RedisStore {
 	}
 }
 
-// redisVal is the json container that lives in redis and is used by the Get and Set methods
+// redisVal is the json container that lives in redis and is used by the Get and Set methods.
+// Expires is the unix time the value expires, and is used to expire history values.
 type redisVal struct {
 	Payload   string `json:"payload"`
 	Timestamp int64  `json:"timestamp"`
+	Expires   int64  `json:"expires,omitempty"`
+}
+
+// redisHistoryLua sets the key and, if the history length in the last argument is
+// more than 1, pushes the value onto the history list KEYS[2], trims it to the history
+// length and extends its expiry to that of the value. It ends the Set and
+// CompareAndSet scripts.
+const redisHistoryLua = `
+	local reply = redis.call("SET", KEYS[1], ARGV[1], "EX", ARGV[3])
+	local n = tonumber(ARGV[#ARGV])
+	if n > 1 then
+		redis.call("LPUSH", KEYS[2], ARGV[1])
+		redis.call("LTRIM", KEYS[2], 0, n - 1)
+		if redis.call("TTL", KEYS[2]) < tonumber(ARGV[3]) then
+			redis.call("EXPIRE", KEYS[2], ARGV[3])
+		end
+	end
+	return reply
+	`
+
+// historyKey returns the key of the history list of key. Endpoint keys are URL safe
+// base64, so they can not collide with a history key.
+func historyKey(key string) string {
+	return key + ":history"
+}
+
+// encodeRedisVal returns the encoded redisVal of a value set at reference time now
+func encodeRedisVal(now time.Time, value []byte, ttl time.Duration, timestamp time.Time) []byte {
+	enc, _ := json.Marshal(redisVal{
+		Payload:   base64.StdEncoding.EncodeToString(value),
+		Timestamp: timestamp.UnixNano(),
+		Expires:   now.Add(safeTTL(ttl)).Unix(),
+	})
+	return enc
 }
 
 // Get method for RedisStore
@@ -148,8 +202,11 @@ func (s *RedisStore) Get(key string) ([]byte, error) {
 	defer c.Close()
 
 	data, err := redis.Bytes(c.Do("GET", key))
+	if err == redis.ErrNil {
+		return []byte{}, ErrNotFound
+	}
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, unavailable(s.logger, err)
 	}
 
 	var v redisVal
@@ -163,11 +220,7 @@ func (s *RedisStore) Get(key string) ([]byte, error) {
 // Set method takes a key, value, and options and saves the base64 encoded value to redis. It returns an error
 // if one is generated by redis
 func (s *RedisStore) Set(key string, value []byte, ttl time.Duration, timestamp time.Time) error {
-	v := redisVal{
-		Payload:   base64.StdEncoding.EncodeToString(value),
-		Timestamp: timestamp.UnixNano(),
-	}
-	enc, _ := json.Marshal(v)
+	enc := encodeRedisVal(time.Now(), value, ttl, timestamp)
 
 	// safeSetLua is a lua script that adds a conditional check before setting a key
 	safeSetLua := `
@@ -178,23 +231,109 @@ func (s *RedisStore) Set(key string, value []byte, ttl time.Duration, timestamp
 				return nil
 			end
 		end
-		return redis.call("SET", KEYS[1], ARGV[1], "EX", ARGV[3])
-		`
+		` + redisHistoryLua
 
 	c := s.pool.Get()
 	defer c.Close()
-	safeSet := redis.NewScript(1, safeSetLua)
+	safeSet := redis.NewScript(2, safeSetLua)
 	// set key with value if timestamp > current timestamp, and set a 10 second TTL
-	reply, err := safeSet.Do(c, key, enc, timestamp.UnixNano(), int(safeTTL(ttl).Seconds()))
+	reply, err := safeSet.Do(c, key, historyKey(key), enc, timestamp.UnixNano(), int(safeTTL(ttl).Seconds()), s.history)
 	if err != nil {
-		return err
+		return unavailable(s.logger, err)
 	}
 	if reply == nil {
-		return errInvalidTimestamp
+		return ErrStaleTimestamp
 	}
 	return nil
 }
 
+// redisCompareAndSetLua is like the safeSetLua script of Set, but first returns 0 if
+// the stored payload is not the expected payload, ARGV[4], which is empty for a
+// missing key
+const redisCompareAndSetLua = `
+	local stored = redis.call("GET", KEYS[1])
+	if not stored then
+		if ARGV[4] ~= "" then
+			return 0
+		end
+	else
+		local v = cjson.decode(stored)
+		if v["payload"] ~= ARGV[4] then
+			return 0
+		end
+		if v["timestamp"]/1000 >= tonumber(ARGV[2])/1000 then
+			return nil
+		end
+	end
+	` + redisHistoryLua
+
+// CompareAndSet is like Set, but returns ErrConflict if the stored value of key is not
+// old. An empty old matches a missing key. The comparison and write are atomic.
+func (s *RedisStore) CompareAndSet(key string, old, value []byte, ttl time.Duration, timestamp time.Time) error {
+	enc := encodeRedisVal(time.Now(), value, ttl, timestamp)
+
+	c := s.pool.Get()
+	defer c.Close()
+	cas := redis.NewScript(2, redisCompareAndSetLua)
+	reply, err := cas.Do(c, key, historyKey(key), enc, timestamp.UnixNano(), int(safeTTL(ttl).Seconds()), base64.StdEncoding.EncodeToString(old), s.history)
+	if err != nil {
+		return unavailable(s.logger, err)
+	}
+	switch reply {
+	case nil:
+		return ErrStaleTimestamp
+	case int64(0):
+		return ErrConflict
+	}
+	return nil
+}
+
+// List returns the unexpired values of key, newest first. Unless history is enabled
+// with WithRedisHistory, that is at most the current value.
+func (s *RedisStore) List(key string) ([][]byte, error) {
+	if s.history <= 1 {
+		v, err := s.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{v}, nil
+	}
+	c := s.pool.Get()
+	defer c.Close()
+
+	items, err := redis.ByteSlices(c.Do("LRANGE", historyKey(key), 0, s.history-1))
+	if err != nil {
+		return nil, unavailable(s.logger, err)
+	}
+	now := time.Now().Unix()
+	var values [][]byte
+	for _, item := range items {
+		var v redisVal
+		if err := json.Unmarshal(item, &v); err != nil {
+			return nil, err
+		}
+		if v.Expires <= now {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(v.Payload)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, b)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+	return values, nil
+}
+
+// PoolStats returns the number of active connections, which includes idle connections,
+// and the number of idle connections in the pool.
+func (s *RedisStore) PoolStats() (active int, idle int) {
+	stats := s.pool.Stats()
+	return stats.ActiveCount, stats.IdleCount
+}
+
 // Close implements the standard Close method for storage
 func (s *RedisStore) Close() error {
 	return s.pool.Close()
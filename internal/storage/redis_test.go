@@ -176,6 +176,25 @@ func TestRedisStore(t *testing.T) {
 			t.Error("failed to catch invalid timestamp")
 		}
 	})
+	t.Run("CompareAndSet", func(t *testing.T) {
+		testCompareAndSet(t, s, "compare")
+	})
+	t.Run("List", func(t *testing.T) {
+		h := NewRedisStore(WithRedisEndpoint(r.Addr()), WithRedisAuth(auth), WithRedisHistory(3))
+		defer h.Close()
+		testHistory(t, h, "history")
+		if ttl := r.TTL(historyKey("history")); ttl <= 0 {
+			t.Errorf("history list has no expiry: %v", ttl)
+		}
+		expired, _ := json.Marshal(redisVal{Payload: base64.StdEncoding.EncodeToString([]byte("expired")), Expires: time.Now().Add(-time.Second).Unix()})
+		r.Lpush(historyKey("history"), string(expired))
+		if values, err := h.List("history"); err != nil || len(values) != 2 || string(values[0]) != "four" {
+			t.Errorf("failed to skip expired value: %q, %v", values, err)
+		}
+		if values, err := s.List("history"); err != nil || len(values) != 1 || string(values[0]) != "four" {
+			t.Errorf("unexpected list without history: %q, %v", values, err)
+		}
+	})
 	t.Run("Malformed_Get", func(t *testing.T) {
 		k := "invalidGet"
 		r.Set(k, "malformed")
@@ -2,6 +2,9 @@ package storage
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/nomasters/hashmap/pkg/payload"
@@ -15,6 +18,8 @@ const (
 	_ Engine = iota
 	MemoryEngine
 	RedisEngine
+	DynamoEngine
+	DiskEngine
 )
 
 var (
@@ -22,11 +27,47 @@ var (
 	maxTTL = payload.MaxTTL
 )
 
+// Errors returned by the storage engines. Engine specific errors that are not one
+// of these are wrapped with ErrUnavailable when they come from the backing service.
 var (
-	errInvalidTimestamp = errors.New("storage: invalid timestamp")
-	errInvalidStorage   = errors.New("invalid storage engine")
+	// ErrNotFound is returned by Get when a key does not exist or has expired
+	ErrNotFound = errors.New("storage: key not found")
+	// ErrStaleTimestamp is returned by Set when the stored timestamp is newer or equal
+	ErrStaleTimestamp = errors.New("storage: stale timestamp")
+	// ErrConflict is returned by CompareAndSet when the stored value has changed
+	ErrConflict = errors.New("storage: stored value has changed")
+	// ErrFull is returned by Set when a bounded store cannot accept a new entry
+	ErrFull = errors.New("storage: store is full")
+	// ErrUnavailable is returned when the backing service cannot be reached
+	ErrUnavailable = errors.New("storage: backend unavailable")
+
+	errInvalidStorage = errors.New("invalid storage engine")
 )
 
+// unavailable logs a backing service error and wraps it with ErrUnavailable
+func unavailable(l *slog.Logger, err error) error {
+	l.Error("storage backend unavailable", "error", err)
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+// engineNames maps the configuration name of an Engine to its enum value
+var engineNames = map[string]Engine{
+	"memory": MemoryEngine,
+	"redis":  RedisEngine,
+	"dynamo": DynamoEngine,
+	"disk":   DiskEngine,
+}
+
+// ParseEngine takes a configuration string, such as "memory", "redis", "dynamo" or "disk", and returns
+// the matching Engine. It returns an error for unknown engine names.
+func ParseEngine(s string) (Engine, error) {
+	e, ok := engineNames[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", errInvalidStorage, s)
+	}
+	return e, nil
+}
+
 // Getter is an interface that wraps around the standard Get method.
 type Getter interface {
 	Get(key string) ([]byte, error)
@@ -42,6 +83,22 @@ type Setter interface {
 	Set(key string, value []byte, ttl time.Duration, timestamp time.Time) error
 }
 
+// CompareAndSetter is an optional interface for a Setter that replaces a value only if
+// it is unchanged since it was read, so that a new payload can be checked against the
+// payload it replaces. old is the value returned by Get, or empty if Get returned
+// ErrNotFound. It returns ErrConflict if the stored value is not old, and otherwise
+// behaves like Set, including the timestamp check.
+type CompareAndSetter interface {
+	CompareAndSet(key string, old, value []byte, ttl time.Duration, timestamp time.Time) error
+}
+
+// Lister is an optional interface for a store that keeps the history of a key. List
+// returns the unexpired values retained for a key, newest first, each of which
+// expires with its own ttl. It returns ErrNotFound if there are none.
+type Lister interface {
+	List(key string) ([][]byte, error)
+}
+
 // Closer is an interface that wraps around the standard Close method.
 type Closer interface {
 	Close() error
@@ -57,7 +114,11 @@ type GetSetCloser interface {
 // options is us to store Storage related Options
 type options struct {
 	engine Engine
+	memory []MemoryOption
 	redis  []RedisOption
+	dynamo []DynamoOption
+	disk   []DiskOption
+	logger *slog.Logger
 }
 
 // Option is used for special Settings in Storage
@@ -75,11 +136,29 @@ func parseOptions(opts ...Option) options {
 // New is a helper function that takes an arbitrary number of options and returns a GetSetCloser interface
 func New(opts ...Option) (GetSetCloser, error) {
 	o := parseOptions(opts...)
+	if o.logger != nil {
+		o.memory = append(o.memory, func(m *memoryOptions) { m.logger = o.logger })
+		o.redis = append(o.redis, func(r *redisOptions) { r.logger = o.logger })
+		o.dynamo = append(o.dynamo, func(d *dynamoOptions) { d.logger = o.logger })
+		o.disk = append(o.disk, func(d *diskOptions) { d.logger = o.logger })
+	}
 	switch o.engine {
 	case MemoryEngine:
-		return NewMemoryStore(), nil
+		return NewMemoryStore(o.memory...), nil
 	case RedisEngine:
 		return NewRedisStore(o.redis...), nil
+	case DynamoEngine:
+		s, err := NewDynamoStore(o.dynamo...)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case DiskEngine:
+		s, err := NewDiskStore(o.disk...)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
 	default:
 		return nil, errInvalidStorage
 	}
@@ -92,6 +171,13 @@ func WithEngine(e Engine) Option {
 	}
 }
 
+// WithMemoryOptions takes an arbitrary number of MemoryOption and returns a Option
+func WithMemoryOptions(opts ...MemoryOption) Option {
+	return func(o *options) {
+		o.memory = opts
+	}
+}
+
 // WithRedisOptions takes an arbitrary number of RedisOption and returns a Option
 func WithRedisOptions(opts ...RedisOption) Option {
 	return func(o *options) {
@@ -99,6 +185,40 @@ func WithRedisOptions(opts ...RedisOption) Option {
 	}
 }
 
+// WithDynamoOptions takes an arbitrary number of DynamoOption and returns a Option
+func WithDynamoOptions(opts ...DynamoOption) Option {
+	return func(o *options) {
+		o.dynamo = opts
+	}
+}
+
+// WithDiskOptions takes an arbitrary number of DiskOption and returns a Option
+func WithDiskOptions(opts ...DiskOption) Option {
+	return func(o *options) {
+		o.disk = opts
+	}
+}
+
+// WithLogger takes a slog.Logger and returns an Option for logging backend failures,
+// compaction and eviction. Defaults to slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// ParseEvictionPolicy takes a configuration string, "expiring" or "reject", and returns
+// the matching EvictionPolicy. An empty string returns RejectWhenFull.
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "reject":
+		return RejectWhenFull, nil
+	case "expiring":
+		return EvictExpiringFirst, nil
+	}
+	return 0, fmt.Errorf("invalid eviction policy: %q", s)
+}
+
 // safeTTL ensures that a submitted TTL is no less than 2x the SubmitWindow duration, to prevent replay attacks
 // it also ensures that the maxTTL is no greater than allowed.
 func safeTTL(ttl time.Duration) time.Duration {
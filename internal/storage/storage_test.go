@@ -1,6 +1,12 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -11,8 +17,16 @@ func TestNewStorage(t *testing.T) {
 	t.Run("memory storage", func(t *testing.T) {
 		t.Parallel()
 
-		if _, err := New(WithEngine(MemoryEngine)); err != nil {
-			t.Error(err)
+		s, err := New(
+			WithEngine(MemoryEngine),
+			WithMemoryOptions(WithMemoryMaxEntries(10), WithMemoryEvictionPolicy(RejectWhenFull)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if s.(*MemoryStore).options.maxEntries != 10 {
+			t.Error("memory options not applied")
 		}
 	})
 
@@ -27,6 +41,35 @@ func TestNewStorage(t *testing.T) {
 		}
 	})
 
+	t.Run("dynamo storage", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := New(
+			WithEngine(DynamoEngine),
+			WithDynamoOptions(WithDynamoRegion("us-east-1"), WithDynamoEndpoint("http://localhost:8000")),
+		); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("disk storage", func(t *testing.T) {
+		t.Parallel()
+
+		dir, err := ioutil.TempDir("", "hashmap-storage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		s, err := New(
+			WithEngine(DiskEngine),
+			WithDiskOptions(WithDiskPath(filepath.Join(dir, "hashmap.db"))),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	})
+
 	t.Run("invalid storage engine", func(t *testing.T) {
 		t.Parallel()
 
@@ -35,6 +78,54 @@ func TestNewStorage(t *testing.T) {
 		}
 	})
 
+	t.Run("ParseEngine", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name      string
+			expected  Engine
+			shouldErr bool
+		}{
+			{name: "memory", expected: MemoryEngine},
+			{name: " Redis ", expected: RedisEngine},
+			{name: "dynamo", expected: DynamoEngine},
+			{name: "disk", expected: DiskEngine},
+			{name: "", shouldErr: true},
+			{name: "cassandra", shouldErr: true},
+		}
+
+		for _, test := range tests {
+			e, err := ParseEngine(test.name)
+			if test.shouldErr {
+				if !errors.Is(err, errInvalidStorage) {
+					t.Errorf("failed to catch invalid engine: %q: %v", test.name, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if e != test.expected {
+				t.Errorf("actual: %v, expected: %v", e, test.expected)
+			}
+		}
+	})
+
+	t.Run("ParseEvictionPolicy", func(t *testing.T) {
+		t.Parallel()
+
+		if p, err := ParseEvictionPolicy(""); err != nil || p != RejectWhenFull {
+			t.Error("failed to default to RejectWhenFull")
+		}
+		if p, err := ParseEvictionPolicy("expiring"); err != nil || p != EvictExpiringFirst {
+			t.Error("failed to parse expiring")
+		}
+		if _, err := ParseEvictionPolicy("lru"); err == nil {
+			t.Error("failed to catch invalid policy")
+		}
+	})
+
 	t.Run("safeTTL", func(t *testing.T) {
 		t.Parallel()
 
@@ -70,3 +161,67 @@ func TestNewStorage(t *testing.T) {
 		}
 	})
 }
+
+// testCompareAndSet runs the CompareAndSet checks shared by every engine that
+// implements CompareAndSetter
+func testCompareAndSet(t *testing.T, s CompareAndSetter, key string) {
+	t.Helper()
+	now := time.Now()
+	first, second := []byte("first"), []byte("second")
+
+	if err := s.CompareAndSet(key, nil, first, time.Minute, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompareAndSet(key, nil, second, time.Minute, now.Add(time.Millisecond)); err != ErrConflict {
+		t.Errorf("failed to catch existing value: %v", err)
+	}
+	if err := s.CompareAndSet(key, second, second, time.Minute, now.Add(time.Millisecond)); err != ErrConflict {
+		t.Errorf("failed to catch changed value: %v", err)
+	}
+	if err := s.CompareAndSet(key, first, second, time.Minute, now); err != ErrStaleTimestamp && err != ErrConflict {
+		t.Errorf("failed to catch stale timestamp: %v", err)
+	}
+	if err := s.CompareAndSet(key, first, second, time.Minute, now.Add(time.Millisecond)); err != nil {
+		t.Error(err)
+	}
+	actual, err := s.(Getter).Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, second) {
+		t.Errorf("actual: %s, expected: %s", actual, second)
+	}
+}
+
+// testHistory runs the List checks shared by every engine that implements Lister, for
+// a store that keeps a history of 3 values
+func testHistory(t *testing.T, s interface {
+	Setter
+	Lister
+}, key string) {
+	t.Helper()
+	now := time.Now()
+
+	if _, err := s.List(key); err != ErrNotFound {
+		t.Errorf("failed to catch missing key: %v", err)
+	}
+	for i, v := range []string{"one", "two", "three", "four"} {
+		if err := s.Set(key, []byte(v), time.Minute, now.Add(time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Set(key, []byte("stale"), time.Minute, now); err != ErrStaleTimestamp {
+		t.Errorf("failed to catch stale timestamp: %v", err)
+	}
+	values, err := s.List(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, v := range values {
+		actual = append(actual, string(v))
+	}
+	if expected := "four,three,two"; strings.Join(actual, ",") != expected {
+		t.Errorf("actual: %v, expected: %v", actual, expected)
+	}
+}
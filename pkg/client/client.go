@@ -0,0 +1,350 @@
+// Package client is a Go client for publishing and fetching payloads on a
+// hashmap server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	payload "github.com/nomasters/hashmap/pkg/payload"
+)
+
+const (
+	defaultTimeout = 15 * time.Second
+	defaultRetries = 2
+	defaultBackoff = 250 * time.Millisecond
+	maxErrorBody   = 4 * 1024
+	maxHistorySize = 64 * payload.MaxPayloadSize
+)
+
+var (
+	// ErrNotFound is returned when no payload exists for an endpoint
+	ErrNotFound = errors.New("client: payload not found")
+	// ErrStaleTimestamp is returned when the server already holds a payload with
+	// an equal or newer timestamp for the endpoint
+	ErrStaleTimestamp = errors.New("client: stale payload timestamp")
+	// ErrBrokenChain is returned when a payload does not follow the chained payload
+	// the server holds for the endpoint
+	ErrBrokenChain = errors.New("client: payload does not follow the stored payload")
+	// ErrConflict is returned when the payload for an endpoint changed concurrently
+	// while the server was storing a new one
+	ErrConflict = errors.New("client: payload changed concurrently")
+	// ErrValidation is returned when a payload is rejected by the server or fails
+	// local verification
+	ErrValidation = errors.New("client: payload validation failed")
+	// ErrTransport is returned for network failures and server errors that
+	// persisted through all retries
+	ErrTransport = errors.New("client: transport failure")
+)
+
+// Error is the error type returned by Client methods. Kind is one of ErrNotFound,
+// ErrStaleTimestamp, ErrBrokenChain, ErrConflict, ErrValidation or ErrTransport and
+// can be matched with errors.Is.
+// Code is the machine-readable error code from the server response body, if any.
+type Error struct {
+	Kind       error
+	StatusCode int
+	Code       string
+	Message    string
+	Err        error
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Kind.Error())
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " (status %d)", e.StatusCode)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %v", e.Message)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+// Is reports whether target is the Kind of the Error
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap returns the underlying error, if any
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Option is func signature used for setting Client options
+type Option func(*options)
+
+// options contains private fields used for Option
+type options struct {
+	baseRoute string
+	timeout   time.Duration
+	retries   int
+	backoff   time.Duration
+	transport http.RoundTripper
+	format    payload.Format
+}
+
+// WithBaseRoute takes a string and returns an Option func for setting the route the
+// server handlers are mounted on. Defaults to "/".
+func WithBaseRoute(r string) Option {
+	return func(o *options) {
+		o.baseRoute = r
+	}
+}
+
+// WithTimeout takes a time.Duration and returns an Option func for setting the
+// timeout of each individual request attempt.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithRetries takes an int and returns an Option func for setting how many times a
+// request is retried after a transport failure or a 5xx response. A POST is only
+// retried after a transport failure or a 429 or 503 response.
+func WithRetries(n int) Option {
+	return func(o *options) {
+		o.retries = n
+	}
+}
+
+// WithBackoff takes a time.Duration and returns an Option func for setting the
+// initial retry delay. The delay doubles after every attempt.
+func WithBackoff(d time.Duration) Option {
+	return func(o *options) {
+		o.backoff = d
+	}
+}
+
+// WithTransport takes an http.RoundTripper and returns an Option func for setting
+// the transport used by the underlying http.Client.
+func WithTransport(t http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = t
+	}
+}
+
+// WithFormat takes a payload.Format and returns an Option func for setting the
+// wire encoding used for requests. Defaults to payload.FormatProtobuf.
+func WithFormat(f payload.Format) Option {
+	return func(o *options) {
+		o.format = f
+	}
+}
+
+// Client talks to a hashmap server.
+type Client struct {
+	base    *url.URL
+	http    *http.Client
+	retries int
+	backoff time.Duration
+	format  payload.Format
+}
+
+// New takes a base URL, such as https://hashmap.example.com, and an arbitrary number
+// of options and returns a Client.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	o := options{
+		baseRoute: "/",
+		timeout:   defaultTimeout,
+		retries:   defaultRetries,
+		backoff:   defaultBackoff,
+		format:    payload.FormatProtobuf,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: invalid base url scheme: %q", baseURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + strings.Trim(o.baseRoute, "/")
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &Client{
+		base:    u,
+		http:    &http.Client{Transport: o.transport, Timeout: o.timeout},
+		retries: o.retries,
+		backoff: o.backoff,
+		format:  o.format,
+	}, nil
+}
+
+// Put encodes and submits a signed payload to the server.
+func (c *Client) Put(ctx context.Context, p payload.Payload) error {
+	b, err := payload.MarshalFormat(p, c.format)
+	if err != nil {
+		return &Error{Kind: ErrValidation, Err: err}
+	}
+	resp, err := c.do(ctx, "POST", c.base.String(), b)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get fetches the payload for an endpoint without verifying it.
+func (c *Client) Get(ctx context.Context, endpoint string) (payload.Payload, error) {
+	u := c.base.String() + url.PathEscape(endpoint)
+	resp, err := c.do(ctx, "GET", u, nil)
+	if err != nil {
+		return payload.Payload{}, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, payload.MaxPayloadSize+1))
+	if err != nil {
+		return payload.Payload{}, &Error{Kind: ErrTransport, Err: err}
+	}
+	p, err := payload.UnmarshalFormat(b, payload.DetectFormat(b))
+	if err != nil {
+		return payload.Payload{}, &Error{Kind: ErrValidation, Err: err}
+	}
+	return p, nil
+}
+
+// GetVerified fetches the payload for an endpoint and verifies its signatures and
+// that its public keys hash to the requested endpoint.
+func (c *Client) GetVerified(ctx context.Context, endpoint string) (payload.Payload, error) {
+	p, err := c.Get(ctx, endpoint)
+	if err != nil {
+		return payload.Payload{}, err
+	}
+	if err := p.Verify(payload.WithValidateEndpoint(endpoint)); err != nil {
+		return payload.Payload{}, &Error{Kind: ErrValidation, Err: err}
+	}
+	return p, nil
+}
+
+// History fetches the payloads retained by the server for an endpoint, newest first,
+// and verifies each of them like GetVerified. Servers without history retention
+// return at most the current payload, or ErrNotFound if they do not serve history.
+func (c *Client) History(ctx context.Context, endpoint string) ([]payload.Payload, error) {
+	u := c.base.String() + url.PathEscape(endpoint) + "/history"
+	resp, err := c.do(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHistorySize+1))
+	if err != nil {
+		return nil, &Error{Kind: ErrTransport, Err: err}
+	}
+	if len(b) > maxHistorySize {
+		return nil, &Error{Kind: ErrValidation, Err: errors.New("history exceeds the maximum size")}
+	}
+	var history []payload.Payload
+	if err := json.Unmarshal(b, &history); err != nil {
+		return nil, &Error{Kind: ErrValidation, Err: err}
+	}
+	for _, p := range history {
+		if err := p.Verify(payload.WithValidateEndpoint(endpoint)); err != nil {
+			return nil, &Error{Kind: ErrValidation, Err: err}
+		}
+	}
+	return history, nil
+}
+
+// do sends a request, retrying transport failures and retryable responses with
+// exponential backoff. Non-2xx responses are returned as an *Error.
+func (c *Client) do(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	delay := c.backoff
+	var lastErr error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil, &Error{Kind: ErrTransport, Err: ctx.Err()}
+			case <-t.C:
+			}
+			delay *= 2
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, &Error{Kind: ErrTransport, Err: err}
+		}
+		req.Header.Set("Accept", c.format.ContentType())
+		if body != nil {
+			req.Header.Set("Content-Type", c.format.ContentType())
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			lastErr = &Error{Kind: ErrTransport, Err: err}
+			if ctx.Err() != nil {
+				return nil, lastErr
+			}
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		lastErr = responseError(resp)
+		if !retryable(method, resp.StatusCode) {
+			return nil, lastErr
+		}
+	}
+	return nil, lastErr
+}
+
+// retryable returns true for status codes that may succeed on a later attempt. A POST
+// is only retried when the server did not process it, since retrying a write that was
+// stored but answered with an error would report it as stale.
+func retryable(method string, code int) bool {
+	if method == http.MethodPost {
+		return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+	}
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// responseError reads and closes a non-2xx response and returns an *Error with a
+// Kind based on the status code.
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(b)),
+	}
+	var body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(b, &body) == nil && body.Code != "" {
+		e.Code, e.Message = body.Code, body.Message
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case resp.StatusCode == http.StatusConflict && e.Code == "broken_chain":
+		e.Kind = ErrBrokenChain
+	case resp.StatusCode == http.StatusConflict && e.Code == "conflict":
+		e.Kind = ErrConflict
+	case resp.StatusCode == http.StatusConflict:
+		e.Kind = ErrStaleTimestamp
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrTransport
+	default:
+		e.Kind = ErrValidation
+	}
+	return e
+}
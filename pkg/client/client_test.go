@@ -0,0 +1,290 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	payload "github.com/nomasters/hashmap/pkg/payload"
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+// fakeServer is a minimal in-memory stand-in for a hashmap server
+type fakeServer struct {
+	sync.Mutex
+	payloads map[string]payload.Payload
+	status   int
+	requests int
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests++
+	if f.status != 0 {
+		http.Error(w, "forced error", f.status)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		b, _ := ioutil.ReadAll(r.Body)
+		p, err := payload.UnmarshalFormat(b, payload.FormatFromContentType(r.Header.Get("Content-Type")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if old, ok := f.payloads[p.Endpoint()]; ok && !p.Timestamp.After(old.Timestamp) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"code":"stale_timestamp","message":"storage: stale timestamp"}`))
+			return
+		}
+		if old, ok := f.payloads[p.Endpoint()]; ok && p.Follows(old) != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"code":"broken_chain","message":"payload does not follow the previous payload"}`))
+			return
+		}
+		f.payloads[p.Endpoint()] = p
+	case "GET":
+		if k := strings.TrimSuffix(r.URL.Path, "/history"); k != r.URL.Path {
+			p, ok := f.payloads[strings.TrimPrefix(k, "/v1/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			b, _ := json.Marshal([]payload.Payload{p})
+			w.Header().Set("Content-Type", payload.ContentTypeJSON)
+			w.Write(b)
+			return
+		}
+		p, ok := f.payloads[strings.TrimPrefix(r.URL.Path, "/v1/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		format := payload.FormatFromAccept(r.Header.Get("Accept"))
+		b, _ := payload.MarshalFormat(p, format)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Write(b)
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeServer{payloads: make(map[string]payload.Payload)}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	ctx := context.Background()
+	signers := []sig.Signer{sig.GenNaclSign()}
+	now := time.Now()
+	p, err := payload.Generate([]byte("hello, world"), signers, payload.WithTimestamp(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []payload.Format{payload.FormatJSON, payload.FormatProtobuf} {
+		c, err := New(ts.URL, WithBaseRoute("/v1"), WithFormat(format), WithBackoff(time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.payloads = make(map[string]payload.Payload)
+
+		if _, err := c.Get(ctx, p.Endpoint()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+		if err := c.Put(ctx, p); err != nil {
+			t.Error(err)
+		}
+		err = c.Put(ctx, p)
+		if !errors.Is(err, ErrStaleTimestamp) {
+			t.Errorf("expected ErrStaleTimestamp, got: %v", err)
+		}
+		var e *Error
+		if errors.As(err, &e) && (e.Code != "stale_timestamp" || e.Message != "storage: stale timestamp") {
+			t.Errorf("unexpected error body: %v, %v", e.Code, e.Message)
+		}
+		o, err := c.GetVerified(ctx, p.Endpoint())
+		if err != nil {
+			t.Error(err)
+		}
+		if string(o.Data) != "hello, world" {
+			t.Errorf("data: %s", o.Data)
+		}
+	}
+
+	t.Run("GetVerified rejects mismatched endpoint", func(t *testing.T) {
+		c, _ := New(ts.URL, WithBaseRoute("/v1"))
+		other, _ := payload.Generate([]byte("other"), []sig.Signer{sig.GenNaclSign()})
+		f.Lock()
+		f.payloads[other.Endpoint()] = p
+		f.Unlock()
+		if _, err := c.GetVerified(ctx, other.Endpoint()); !errors.Is(err, ErrValidation) {
+			t.Errorf("expected ErrValidation, got: %v", err)
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		c, _ := New(ts.URL, WithBaseRoute("/v1"))
+		history, err := c.History(ctx, p.Endpoint())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || string(history[0].Data) != "hello, world" {
+			t.Errorf("unexpected history: %v", history)
+		}
+		other, _ := payload.Generate([]byte("other"), []sig.Signer{sig.GenNaclSign()})
+		if _, err := c.History(ctx, other.Endpoint()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("broken chain", func(t *testing.T) {
+		c, _ := New(ts.URL, WithBaseRoute("/v1"))
+		first, _ := payload.Generate([]byte("first"), signers, payload.WithSequence(1), payload.WithTimestamp(now.Add(time.Second)))
+		skipped, _ := payload.Generate([]byte("third"), signers, payload.WithSequence(3), payload.WithTimestamp(now.Add(2*time.Second)))
+		if err := c.Put(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Put(ctx, skipped); !errors.Is(err, ErrBrokenChain) {
+			t.Errorf("expected ErrBrokenChain, got: %v", err)
+		}
+	})
+
+	t.Run("validation status", func(t *testing.T) {
+		c, _ := New(ts.URL, WithBaseRoute("/v1"))
+		f.Lock()
+		f.status = http.StatusUnprocessableEntity
+		f.Unlock()
+		defer func() {
+			f.Lock()
+			f.status = 0
+			f.Unlock()
+		}()
+		err := c.Put(ctx, p)
+		var e *Error
+		if !errors.As(err, &e) || e.StatusCode != http.StatusUnprocessableEntity || !errors.Is(err, ErrValidation) {
+			t.Errorf("expected ErrValidation, got: %v", err)
+		}
+	})
+}
+
+func TestClientConflict(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"code":"conflict","message":"storage: stored value has changed"}`))
+	}))
+	defer ts.Close()
+
+	c, _ := New(ts.URL)
+	p, _ := payload.Generate([]byte("hello, world"), []sig.Signer{sig.GenNaclSign()})
+	err := c.Put(context.Background(), p)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict, got: %v", err)
+	}
+	if errors.Is(err, ErrStaleTimestamp) {
+		t.Error("conflict should not be reported as a stale timestamp")
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeServer{payloads: make(map[string]payload.Payload), status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	c, _ := New(ts.URL, WithRetries(3), WithBackoff(time.Millisecond))
+	if _, err := c.Get(context.Background(), "endpoint"); !errors.Is(err, ErrTransport) {
+		t.Errorf("expected ErrTransport, got: %v", err)
+	}
+	if f.requests != 4 {
+		t.Errorf("requests: %v, expected: 4", f.requests)
+	}
+
+	t.Run("POST is not retried after a gateway timeout", func(t *testing.T) {
+		f := &fakeServer{payloads: make(map[string]payload.Payload), status: http.StatusGatewayTimeout}
+		ts := httptest.NewServer(f)
+		defer ts.Close()
+		c, _ := New(ts.URL, WithRetries(3), WithBackoff(time.Millisecond))
+		p, _ := payload.Generate([]byte("hello, world"), []sig.Signer{sig.GenNaclSign()})
+		if err := c.Put(context.Background(), p); !errors.Is(err, ErrTransport) {
+			t.Errorf("expected ErrTransport, got: %v", err)
+		}
+		if f.requests != 1 {
+			t.Errorf("requests: %v, expected: 1", f.requests)
+		}
+	})
+
+	t.Run("POST is retried after service unavailable", func(t *testing.T) {
+		c, _ := New(ts.URL, WithRetries(1), WithBackoff(time.Millisecond))
+		p, _ := payload.Generate([]byte("hello, world"), []sig.Signer{sig.GenNaclSign()})
+		f.Lock()
+		f.requests = 0
+		f.Unlock()
+		if err := c.Put(context.Background(), p); !errors.Is(err, ErrTransport) {
+			t.Errorf("expected ErrTransport, got: %v", err)
+		}
+		if f.requests != 2 {
+			t.Errorf("requests: %v, expected: 2", f.requests)
+		}
+	})
+
+	t.Run("canceled context stops retries", func(t *testing.T) {
+		c, _ := New(ts.URL, WithRetries(3), WithBackoff(time.Hour))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := c.Get(ctx, "endpoint"); !errors.Is(err, ErrTransport) {
+			t.Errorf("expected ErrTransport, got: %v", err)
+		}
+	})
+}
+
+// roundTripFunc adapts a func to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClientTransport(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if r.URL.String() != "https://hashmap.example.com/api/abc" {
+			t.Errorf("unexpected url: %v", r.URL)
+		}
+		return nil, errors.New("connection refused")
+	})
+	c, err := New("https://hashmap.example.com/", WithBaseRoute("/api/"), WithTransport(rt), WithRetries(1), WithBackoff(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(context.Background(), "abc"); !errors.Is(err, ErrTransport) {
+		t.Errorf("expected ErrTransport, got: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls: %v, expected: 2", calls)
+	}
+	if _, err := New("hashmap.example.com"); err == nil {
+		t.Error("failed to catch invalid base url")
+	}
+}
@@ -0,0 +1,88 @@
+package payload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	blake2b "golang.org/x/crypto/blake2b"
+)
+
+var (
+	// ErrInvalidChain is returned for a payload with a malformed Sequence or Prev
+	ErrInvalidChain = errors.New("invalid payload chain")
+	// ErrBrokenChain is returned by Follows when a payload is not the successor of
+	// the payload it replaces
+	ErrBrokenChain = errors.New("payload does not follow the previous payload")
+)
+
+// WithSequence sets the Sequence of a generated payload, starting a chain, and the
+// version to V3. The payloads that follow it are generated with WithPrevious.
+func WithSequence(n uint64) Option {
+	return func(o *options) {
+		o.sequence = n
+		o.version = V3
+	}
+}
+
+// WithPrevious chains a generated payload to prev, the payload it replaces, by
+// setting its Sequence to the next sequence number and its Prev to the Hash of prev.
+// A prev that is not chained starts a chain at sequence 1. The version is set to V3.
+func WithPrevious(prev Payload) Option {
+	return func(o *options) {
+		o.sequence = prev.Sequence + 1
+		o.prev = prev.Hash()
+		o.version = V3
+	}
+}
+
+// Hash returns the blake2b-512 hash of the SigningBytes of a payload. It identifies
+// the signed content of a payload independently of its encoding and signatures,
+// and is the Prev of the payload that follows it in a chain.
+func (p Payload) Hash() []byte {
+	h := blake2b.Sum512(p.SigningBytes())
+	return h[:]
+}
+
+// IsChained returns true if a payload has a Sequence
+func (p Payload) IsChained() bool {
+	return p.Sequence != 0
+}
+
+// Follows checks that p may replace prev, the payload stored at its endpoint. A
+// chained payload can only be replaced by the chained payload with the next Sequence
+// and a Prev that is the Hash of prev. A payload that is not chained can be replaced
+// by any payload, but a Prev, if set, must be the Hash of prev.
+func (p Payload) Follows(prev Payload) error {
+	switch {
+	case !prev.IsChained():
+		if len(p.Prev) != 0 && !bytes.Equal(p.Prev, prev.Hash()) {
+			return fmt.Errorf("%w: prev is not the hash of the previous payload", ErrBrokenChain)
+		}
+		return nil
+	case !p.IsChained():
+		return fmt.Errorf("%w: chained payload %d can only be replaced by its successor", ErrBrokenChain, prev.Sequence)
+	case p.Sequence != prev.Sequence+1:
+		return fmt.Errorf("%w: sequence %d does not follow %d", ErrBrokenChain, p.Sequence, prev.Sequence)
+	case !bytes.Equal(p.Prev, prev.Hash()):
+		return fmt.Errorf("%w: prev is not the hash of payload %d", ErrBrokenChain, prev.Sequence)
+	}
+	return nil
+}
+
+// validChain checks that only V3 payloads are chained, and that a Prev is a hash
+// and is only set with a Sequence
+func (p Payload) validChain() error {
+	if !p.IsChained() && len(p.Prev) == 0 {
+		return nil
+	}
+	switch {
+	case p.Version != V3:
+		return fmt.Errorf("%w: only V3 payloads can be chained", ErrInvalidChain)
+	case !p.IsChained():
+		return fmt.Errorf("%w: prev is set without a sequence", ErrInvalidChain)
+	case len(p.Prev) != 0 && len(p.Prev) != blake2b.Size:
+		return fmt.Errorf("%w: prev is %d bytes, expected %d", ErrInvalidChain, len(p.Prev), blake2b.Size)
+	}
+	return nil
+}
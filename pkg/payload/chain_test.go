@@ -0,0 +1,115 @@
+package payload
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	signers := []sig.Signer{sig.GenNaclSign()}
+	now := time.Now()
+	gen := func(t *testing.T, d time.Duration, opts ...Option) Payload {
+		t.Helper()
+		p, err := Generate([]byte("hello, chain"), signers, append(opts, WithTimestamp(now.Add(d)))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	unchained := gen(t, 0)
+	first := gen(t, time.Millisecond, WithSequence(1))
+	second := gen(t, 2*time.Millisecond, WithPrevious(first))
+	third := gen(t, 3*time.Millisecond, WithPrevious(second))
+
+	t.Run("Generate", func(t *testing.T) {
+		if first.Version != V3 || first.Sequence != 1 || len(first.Prev) != 0 {
+			t.Errorf("unexpected first payload: %v %v %x", first.Version, first.Sequence, first.Prev)
+		}
+		if second.Sequence != 2 || !bytes.Equal(second.Prev, first.Hash()) {
+			t.Errorf("unexpected second payload: %v %x", second.Sequence, second.Prev)
+		}
+		for _, p := range []Payload{first, second, third} {
+			if err := p.Verify(); err != nil {
+				t.Error(err)
+			}
+		}
+		if s := gen(t, 0, WithPrevious(unchained)); s.Sequence != 1 || !bytes.Equal(s.Prev, unchained.Hash()) {
+			t.Error("chain from an unchained payload does not start at 1")
+		}
+	})
+	t.Run("Signed", func(t *testing.T) {
+		p := second
+		p.Sequence = 5
+		if p.VerifySignatures() {
+			t.Error("sequence is not covered by signatures")
+		}
+		p = second
+		p.Prev = unchained.Hash()
+		if p.VerifySignatures() {
+			t.Error("prev is not covered by signatures")
+		}
+	})
+	t.Run("Encoding", func(t *testing.T) {
+		for _, f := range []Format{FormatJSON, FormatProtobuf} {
+			b, err := MarshalFormat(second, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o, err := UnmarshalFormat(b, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Sequence != second.Sequence || !bytes.Equal(o.Hash(), second.Hash()) {
+				t.Errorf("%v: chain fields not preserved", f)
+			}
+		}
+	})
+	t.Run("Follows", func(t *testing.T) {
+		tests := []struct {
+			description string
+			p, prev     Payload
+			shouldErr   bool
+		}{
+			{description: "successor", p: second, prev: first},
+			{description: "start after unchained", p: first, prev: unchained},
+			{description: "linked start after unchained", p: gen(t, 0, WithPrevious(unchained)), prev: unchained},
+			{description: "unchained after unchained", p: unchained, prev: unchained},
+			{description: "skipped sequence", p: third, prev: first, shouldErr: true},
+			{description: "replayed sequence", p: second, prev: second, shouldErr: true},
+			{description: "unchained after chained", p: unchained, prev: first, shouldErr: true},
+			{description: "wrong prev", p: gen(t, 0, WithSequence(2)), prev: first, shouldErr: true},
+			{description: "wrong prev after unchained", p: second, prev: unchained, shouldErr: true},
+		}
+		for _, test := range tests {
+			err := test.p.Follows(test.prev)
+			if test.shouldErr && !errors.Is(err, ErrBrokenChain) {
+				t.Errorf("%v: unexpected error: %v", test.description, err)
+			}
+			if !test.shouldErr && err != nil {
+				t.Errorf("%v: %v", test.description, err)
+			}
+		}
+	})
+	t.Run("Validate", func(t *testing.T) {
+		tests := []struct {
+			description string
+			p           Payload
+		}{
+			{description: "V1 sequence", p: Payload{Version: V1, Sequence: 1}},
+			{description: "prev without sequence", p: Payload{Version: V3, Prev: first.Hash()}},
+			{description: "short prev", p: Payload{Version: V3, Sequence: 2, Prev: []byte{1}}},
+		}
+		for _, test := range tests {
+			if err := test.p.validChain(); !errors.Is(err, ErrInvalidChain) {
+				t.Errorf("%v: unexpected error: %v", test.description, err)
+			}
+		}
+	})
+}
@@ -2,6 +2,8 @@ package payload
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"time"
@@ -21,6 +23,15 @@ const (
 	V0 Version = iota
 	// V1 is the current version of the payload spec
 	V1
+	// V2 is a threshold payload. Its endpoint is derived from a k-of-n Policy
+	// instead of the public keys of its bundles, and it is valid when signed by
+	// at least the threshold number of policy keys.
+	V2
+	// V3 payloads sign a canonical, domain separated encoding that also covers the
+	// keys of the endpoint, see SigningBytes. A V3 payload may carry a threshold
+	// Policy like V2, and may be chained with a Sequence and Prev. Negative
+	// timestamps and TTLs are invalid.
+	V3
 )
 
 const (
@@ -41,6 +52,9 @@ type Payload struct {
 	TTL        time.Duration `json:"ttl"`
 	SigBundles []sig.Bundle  `json:"sig_bundles"`
 	Data       Bytes         `json:"data"`
+	Policy     *Policy       `json:"policy,omitempty"`
+	Sequence   uint64        `json:"sequence,omitempty"`
+	Prev       Bytes         `json:"prev,omitempty"`
 }
 
 // Option is used for interacting with Context when setting options for Generate and Verify
@@ -51,6 +65,9 @@ type options struct {
 	version   Version
 	timestamp time.Time
 	ttl       time.Duration
+	policy    *Policy
+	sequence  uint64
+	prev      []byte
 	validate  validateContext
 }
 
@@ -105,7 +122,15 @@ func parseOptions(opts ...Option) options {
 // This function defaults to time.Now() and the default TTL of 24 hours. Generate Requires
 // at least one signer, but can sign with many signers. Sort order is important though, The unique
 // order of the signers pubkeys are what is responsible for generating the endpoint hash.
+// With WithPolicy the endpoint is derived from the Policy instead, and the signers may be
+// any subset of the policy keys.
 func Generate(message []byte, signers []sig.Signer, opts ...Option) (Payload, error) {
+	return GenerateContext(context.Background(), message, signers, opts...)
+}
+
+// GenerateContext is like Generate but signs with sig.SignContext, so that signing
+// with a sig.ContextSigner, such as a signing agent, can be canceled.
+func GenerateContext(ctx context.Context, message []byte, signers []sig.Signer, opts ...Option) (Payload, error) {
 	if len(signers) == 0 {
 		return Payload{}, errors.New("Generate must have at least one signer")
 	}
@@ -115,20 +140,50 @@ func Generate(message []byte, signers []sig.Signer, opts ...Option) (Payload, er
 		Timestamp: o.timestamp,
 		TTL:       o.ttl,
 		Data:      message,
+		Policy:    o.policy,
+		Sequence:  o.sequence,
+		Prev:      o.prev,
+	}
+
+	if p.Version == V3 {
+		if err := p.validSigningInput(); err != nil {
+			return Payload{}, err
+		}
+		if p.Policy == nil {
+			// the keys of the bundles are part of the V3 SigningBytes
+			keys, err := SignerKeys(signers)
+			if err != nil {
+				return Payload{}, err
+			}
+			for _, k := range keys {
+				p.SigBundles = append(p.SigBundles, sig.Bundle{Alg: k.Alg, Pub: k.Pub})
+			}
+		}
 	}
 
-	sigBundles, err := sigutil.SignAll(p.SigningBytes(), signers)
+	sigBundles, err := sigutil.SignAllContext(ctx, p.SigningBytes(), signers)
 	if err != nil {
 		return Payload{}, err
 	}
 	p.SigBundles = sigBundles
+	if p.Version == V3 {
+		// a signer whose bundle key differs from its sig.Keyer key signed other bytes
+		if err := p.verifySignatures(); err != nil {
+			return Payload{}, err
+		}
+	}
 
 	return p, nil
 }
 
 // SigningBytes returns a byte slice of version|timestamp|ttl|len|data used as
-// the message to be signed by a Signer.
+// the message to be signed by a Signer. For V2 payloads the policy hash is
+// appended, so that signatures are bound to the policy. V3 payloads use the
+// encoding of signingBytesV3.
 func (p Payload) SigningBytes() []byte {
+	if p.Version == V3 {
+		return p.signingBytesV3()
+	}
 	j := [][]byte{
 		uint64ToBytes(uint64(p.Version)),
 		uint64ToBytes(uint64(p.Timestamp.UnixNano())),
@@ -136,9 +191,57 @@ func (p Payload) SigningBytes() []byte {
 		uint64ToBytes(uint64(len(p.Data))),
 		p.Data,
 	}
+	if p.Version == V2 && p.Policy != nil {
+		j = append(j, p.Policy.Hash())
+	}
 	return bytes.Join(j, []byte{})
 }
 
+// signingDomainV3 is the fixed context string that starts the SigningBytes of a V3
+// payload, so that a V3 signature is never a valid signature of a message of another
+// protocol, or of another payload version, made with the same key.
+var signingDomainV3 = []byte("hashmap payload signature v3\x00")
+
+// signingBytesV3 returns domain|version|timestamp|ttl|len|data|len|keys|sequence|len|prev,
+// with every number as a big endian uint64. keys is the Policy Bytes of a threshold
+// payload, or otherwise the keyBytes of the bundles, so that signatures cover the
+// endpoint they are published to. Every variable length field is length prefixed,
+// so the encoding is injective.
+func (p Payload) signingBytesV3() []byte {
+	keys := keyBytes(p.SigBundles)
+	if p.Policy != nil {
+		keys = p.Policy.Bytes()
+	}
+	return bytes.Join([][]byte{
+		signingDomainV3,
+		uint64ToBytes(uint64(p.Version)),
+		uint64ToBytes(uint64(p.Timestamp.UnixNano())),
+		uint64ToBytes(uint64(p.TTL.Nanoseconds())),
+		uint64ToBytes(uint64(len(p.Data))),
+		p.Data,
+		uint64ToBytes(uint64(len(keys))),
+		keys,
+		uint64ToBytes(p.Sequence),
+		uint64ToBytes(uint64(len(p.Prev))),
+		p.Prev,
+	}, []byte{})
+}
+
+// keyBytes returns count followed by alg|len|pub for the key of each bundle, with
+// every number as a big endian uint64
+func keyBytes(bundles []sig.Bundle) []byte {
+	j := [][]byte{uint64ToBytes(uint64(len(bundles)))}
+	for _, b := range bundles {
+		j = append(j, uint64ToBytes(uint64(b.Alg)), uint64ToBytes(uint64(len(b.Pub))), b.Pub)
+	}
+	return bytes.Join(j, []byte{})
+}
+
+// isThreshold returns true for a V2 or V3 payload with a Policy
+func (p Payload) isThreshold() bool {
+	return p.Policy != nil && (p.Version == V2 || p.Version == V3)
+}
+
 // PubKeyBytes returns a byte slice of all pubkeys concatenated in the index
 // order of the slice of sig.Bundles. This is intended to be used with a hash
 // function to derive the unique endpoint for a payload on hashmap server.
@@ -146,14 +249,18 @@ func (p Payload) PubKeyBytes() []byte {
 	return sigutil.BundlePubKeys(p.SigBundles)
 }
 
-// PubKeyHash returns a byte slice of the blake2b-512 hash of PubKeyBytes
+// PubKeyHash returns a byte slice of the blake2b-512 hash of PubKeyBytes. For
+// threshold payloads it returns the Policy hash.
 func (p Payload) PubKeyHash() []byte {
+	if p.isThreshold() {
+		return p.Policy.Hash()
+	}
 	return sigutil.BundleHash(p.SigBundles)
 }
 
 // Endpoint returns a url-safe base64 encoded endpoint string of PubKeyHash
 func (p Payload) Endpoint() string {
-	return sigutil.EncodedBundleHash(p.SigBundles)
+	return base64.URLEncoding.EncodeToString(p.PubKeyHash())
 }
 
 // uint64ToBytes converts uint64 numbers into a byte slice in Big Endian format
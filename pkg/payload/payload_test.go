@@ -2,6 +2,7 @@ package payload
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 	"time"
 
@@ -107,3 +108,102 @@ func TestPayloadCoreMethods(t *testing.T) {
 		}
 	})
 }
+
+func TestSigningBytesV3(t *testing.T) {
+	t.Parallel()
+
+	m := []byte("hello, world")
+	now := time.Now()
+	signers := []sig.Signer{sig.GenNaclSign(), sig.GenECDSAP256()}
+
+	t.Run("Encoding", func(t *testing.T) {
+		p := Payload{
+			Version:    V3,
+			Timestamp:  time.Unix(0, 1),
+			TTL:        2,
+			Data:       []byte("a"),
+			SigBundles: []sig.Bundle{{Alg: sig.AlgNaClSign, Pub: []byte{0xff}, Sig: []byte{0xee}}},
+		}
+		expected := "hashmap payload signature v3\x00" +
+			"\x00\x00\x00\x00\x00\x00\x00\x03" + // version
+			"\x00\x00\x00\x00\x00\x00\x00\x01" + // timestamp
+			"\x00\x00\x00\x00\x00\x00\x00\x02" + // ttl
+			"\x00\x00\x00\x00\x00\x00\x00\x01a" + // data
+			"\x00\x00\x00\x00\x00\x00\x00\x19" + // keys length
+			"\x00\x00\x00\x00\x00\x00\x00\x01" + // key count
+			"\x00\x00\x00\x00\x00\x00\x00\x01" + // alg
+			"\x00\x00\x00\x00\x00\x00\x00\x01\xff" + // pub
+			"\x00\x00\x00\x00\x00\x00\x00\x00" + // sequence
+			"\x00\x00\x00\x00\x00\x00\x00\x00" // prev
+		if actual := string(p.SigningBytes()); actual != expected {
+			t.Errorf("actual: %q, expected: %q", actual, expected)
+		}
+	})
+	t.Run("Generate", func(t *testing.T) {
+		p, err := Generate(m, signers, WithVersion(V3), WithTimestamp(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Verify(); err != nil {
+			t.Error(err)
+		}
+		v1, _ := Generate(m, signers, WithTimestamp(now))
+		if p.Endpoint() != v1.Endpoint() {
+			t.Error("V3 endpoint differs from the V1 endpoint of the same keys")
+		}
+		// a V1 signature relabeled as V3 must not verify
+		v1.Version = V3
+		if v1.VerifySignatures() {
+			t.Error("V1 signatures verified as V3")
+		}
+		// the keys are covered, so reordering bundles invalidates the signatures
+		p.SigBundles[0], p.SigBundles[1] = p.SigBundles[1], p.SigBundles[0]
+		if p.VerifySignatures() {
+			t.Error("reordered bundles verified")
+		}
+	})
+	t.Run("Threshold", func(t *testing.T) {
+		keys, _ := SignerKeys(signers)
+		policy, err := NewPolicy(2, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := Generate(m, signers, WithVersion(V3), WithPolicy(policy), WithTimestamp(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Version != V3 || p.Endpoint() != policy.Endpoint() {
+			t.Errorf("unexpected version %v or endpoint %v", p.Version, p.Endpoint())
+		}
+		if err := p.Verify(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("Negative Timestamp", func(t *testing.T) {
+		past := time.Unix(-1, 0)
+		if _, err := Generate(m, signers, WithVersion(V3), WithTimestamp(past)); !errors.Is(err, ErrInvalidTimestamp) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		p, err := Generate(m, signers, WithTimestamp(past))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Version = V3
+		if err := validate(p, WithValidateExpiration(false)); !errors.Is(err, ErrInvalidTimestamp) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		p.Version = V1
+		if err := validate(p, WithValidateExpiration(false)); err != nil {
+			t.Errorf("V1 validation changed: %v", err)
+		}
+	})
+	t.Run("Negative TTL", func(t *testing.T) {
+		if _, err := Generate(m, signers, WithVersion(V3), WithTTL(-time.Second)); !errors.Is(err, ErrInvalidTTL) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		p := Payload{Version: V3, Timestamp: now, TTL: -time.Second}
+		if err := validate(p, WithValidateTTL(false), WithValidateExpiration(false)); !errors.Is(err, ErrInvalidTTL) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package payload
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	sigutil "github.com/nomasters/hashmap/pkg/sig/sigutil"
+	blake2b "golang.org/x/crypto/blake2b"
+)
+
+// MaxPolicyKeys is the upper limit of keys in a threshold Policy
+const MaxPolicyKeys = 16
+
+// policyDomain prefixes the policy encoding hashed into a V2 endpoint, so that a
+// V2 endpoint can never equal the V1 endpoint of a set of public keys.
+var policyDomain = []byte("hashmap threshold policy v2")
+
+// ErrInvalidPolicy is returned for a threshold payload without a valid Policy
+var ErrInvalidPolicy = errors.New("invalid threshold policy")
+
+// Policy is a k-of-n threshold policy for a V2 or V3 payload. The endpoint of a
+// threshold payload is derived from the policy, so any Threshold of the Keys can
+// publish to it.
+type Policy struct {
+	Threshold uint32      `json:"threshold"`
+	Keys      []PolicyKey `json:"keys"`
+}
+
+// PolicyKey is a public key that may sign for a Policy
+type PolicyKey struct {
+	Alg sig.Alg   `json:"alg"`
+	Pub sig.Bytes `json:"pub"`
+}
+
+// NewPolicy takes a threshold and the keys that may sign and returns a valid Policy.
+// The order of the keys is part of the endpoint.
+func NewPolicy(threshold int, keys []PolicyKey) (*Policy, error) {
+	if threshold < 1 || threshold > MaxSigBundleCount {
+		return nil, fmt.Errorf("%w: threshold %d must be between 1 and %d", ErrInvalidPolicy, threshold, MaxSigBundleCount)
+	}
+	p := &Policy{Threshold: uint32(threshold), Keys: keys}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SignerKeys returns the PolicyKey of each signer, in order
+func SignerKeys(signers []sig.Signer) ([]PolicyKey, error) {
+	keys := make([]PolicyKey, len(signers))
+	for i, s := range signers {
+		k, ok := s.(sig.Keyer)
+		if !ok {
+			return nil, fmt.Errorf("payload: %T does not implement sig.Keyer", s)
+		}
+		keys[i] = PolicyKey{Alg: k.Alg(), Pub: k.PublicKey()}
+	}
+	return keys, nil
+}
+
+// Validate checks that the threshold can be met by the keys, that the number of keys
+// is within MaxPolicyKeys and that every key is a distinct key of a registered Alg.
+func (p *Policy) Validate() error {
+	n := len(p.Keys)
+	switch {
+	case n == 0 || n > MaxPolicyKeys:
+		return fmt.Errorf("%w: %d keys, must be between 1 and %d", ErrInvalidPolicy, n, MaxPolicyKeys)
+	case p.Threshold == 0 || int(p.Threshold) > n || p.Threshold > MaxSigBundleCount:
+		return fmt.Errorf("%w: threshold %d of %d keys, must be between 1 and %d", ErrInvalidPolicy, p.Threshold, n, min(n, MaxSigBundleCount))
+	}
+	for i, k := range p.Keys {
+		a, err := sig.Lookup(k.Alg)
+		if err != nil {
+			return fmt.Errorf("%w: key %d: %w", ErrInvalidPolicy, i, err)
+		}
+		if a.PubKeySize != 0 && len(k.Pub) != a.PubKeySize {
+			return fmt.Errorf("%w: key %d: %v public key is %d bytes, expected %d", ErrInvalidPolicy, i, a.Name, len(k.Pub), a.PubKeySize)
+		}
+		if p.index(k) != i {
+			return fmt.Errorf("%w: key %d is a duplicate", ErrInvalidPolicy, i)
+		}
+	}
+	return nil
+}
+
+// index returns the index of the first policy key equal to k, or -1
+func (p *Policy) index(k PolicyKey) int {
+	for i, pk := range p.Keys {
+		if pk.Alg == k.Alg && bytes.Equal(pk.Pub, k.Pub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Bytes returns the unambiguous encoding of the policy that is hashed into the
+// endpoint: domain|threshold|count, followed by alg|len|pub for each key, with
+// every number as a big endian uint64.
+func (p *Policy) Bytes() []byte {
+	j := [][]byte{
+		policyDomain,
+		uint64ToBytes(uint64(p.Threshold)),
+		uint64ToBytes(uint64(len(p.Keys))),
+	}
+	for _, k := range p.Keys {
+		j = append(j, uint64ToBytes(uint64(k.Alg)), uint64ToBytes(uint64(len(k.Pub))), k.Pub)
+	}
+	return bytes.Join(j, []byte{})
+}
+
+// Hash returns the blake2b-512 hash of the policy Bytes
+func (p *Policy) Hash() []byte {
+	h := blake2b.Sum512(p.Bytes())
+	return h[:]
+}
+
+// Endpoint returns the url-safe base64 encoded endpoint of the policy
+func (p *Policy) Endpoint() string {
+	return base64.URLEncoding.EncodeToString(p.Hash())
+}
+
+// VerifyBundles checks that the bundles are valid signatures of message by distinct
+// policy keys, and that there are at least Threshold of them. Bundles from keys that
+// are not in the policy are rejected rather than ignored.
+func (p *Policy) VerifyBundles(message []byte, bundles []sig.Bundle) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	signed := make([]bool, len(p.Keys))
+	for i, b := range bundles {
+		k := p.index(PolicyKey{Alg: b.Alg, Pub: b.Pub})
+		if k < 0 {
+			return fmt.Errorf("bundle %d: %w: key is not in the policy", i, sig.ErrInvalidSignature)
+		}
+		if signed[k] {
+			return fmt.Errorf("bundle %d: %w: duplicate signature by policy key %d", i, sig.ErrInvalidSignature, k)
+		}
+		if err := sig.VerifyBundle(message, b); err != nil {
+			return fmt.Errorf("bundle %d: %w", i, err)
+		}
+		signed[k] = true
+	}
+	if len(bundles) < int(p.Threshold) {
+		return fmt.Errorf("%w: %d of %d required signatures", sig.ErrInvalidSignature, len(bundles), p.Threshold)
+	}
+	return nil
+}
+
+// WithPolicy sets the threshold Policy of a generated payload, and the version to V2
+// unless V3 is set
+func WithPolicy(p *Policy) Option {
+	return func(o *options) {
+		o.policy = p
+		if o.version != V3 {
+			o.version = V2
+		}
+	}
+}
+
+// Cosign adds the signatures of signers to a threshold payload, so that a threshold payload
+// can be signed by several parties in turn. It returns an error if a signer has
+// already signed the payload.
+func (p *Payload) Cosign(signers []sig.Signer) error {
+	return p.CosignContext(context.Background(), signers)
+}
+
+// CosignContext is like Cosign but signs with sig.SignContext
+func (p *Payload) CosignContext(ctx context.Context, signers []sig.Signer) error {
+	if !p.isThreshold() {
+		return fmt.Errorf("%w: only threshold payloads can be cosigned", ErrInvalidPolicy)
+	}
+	keys, err := SignerKeys(signers)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		for _, b := range p.SigBundles {
+			if b.Alg == k.Alg && bytes.Equal(b.Pub, k.Pub) {
+				return fmt.Errorf("payload: %v key %x has already signed", k.Alg, []byte(k.Pub))
+			}
+		}
+	}
+	bundles, err := sigutil.SignAllContext(ctx, p.SigningBytes(), signers)
+	if err != nil {
+		return err
+	}
+	p.SigBundles = append(p.SigBundles, bundles...)
+	return nil
+}
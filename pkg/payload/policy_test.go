@@ -0,0 +1,143 @@
+package payload
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	operators := []sig.Signer{sig.GenNaclSign(), sig.GenECDSAP256(), sig.GenNaclSign()}
+	keys, err := SignerKeys(operators)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPolicy(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("hello, world")
+	now := time.Now()
+
+	t.Run("threshold", func(t *testing.T) {
+		t.Parallel()
+		p, err := Generate(message, operators[2:], WithPolicy(policy), WithTimestamp(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Version != V2 || p.Endpoint() != policy.Endpoint() {
+			t.Fatalf("unexpected version or endpoint: %v %v", p.Version, p.Endpoint())
+		}
+		if err := p.Verify(); !errors.Is(err, ErrInvalidSignatures) {
+			t.Errorf("failed to catch unmet threshold: %v", err)
+		}
+		if err := p.Cosign(operators[:1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Verify(WithValidateEndpoint(policy.Endpoint())); err != nil {
+			t.Error(err)
+		}
+		if err := p.Cosign(operators[:1]); err == nil {
+			t.Error("failed to catch duplicate cosigner")
+		}
+		for _, f := range []Format{FormatJSON, FormatProtobuf} {
+			b, err := MarshalFormat(p, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := UnmarshalFormat(b, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := u.Verify(WithValidateEndpoint(policy.Endpoint())); err != nil {
+				t.Errorf("format %v: %v", f, err)
+			}
+		}
+	})
+	t.Run("endpoint", func(t *testing.T) {
+		t.Parallel()
+		a, _ := Generate(message, operators[:2], WithPolicy(policy))
+		b, _ := Generate(message, operators[1:], WithPolicy(policy))
+		if a.Endpoint() != b.Endpoint() {
+			t.Error("endpoint depends on the signers")
+		}
+		v1, _ := Generate(message, operators)
+		if v1.Endpoint() == a.Endpoint() {
+			t.Error("V2 endpoint equals V1 endpoint of the same keys")
+		}
+		other, _ := NewPolicy(1, keys)
+		if other.Endpoint() == policy.Endpoint() {
+			t.Error("endpoint does not commit to the threshold")
+		}
+	})
+	t.Run("invalid bundles", func(t *testing.T) {
+		t.Parallel()
+		p, err := Generate(message, operators[:2], WithPolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outsider, err := sig.GenNaclSign().Sign(p.SigningBytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name    string
+			bundles []sig.Bundle
+		}{
+			{"outsider", append([]sig.Bundle{outsider}, p.SigBundles[0])},
+			{"duplicate", []sig.Bundle{p.SigBundles[0], p.SigBundles[0]}},
+		}
+		for _, test := range tests {
+			q := p
+			q.SigBundles = test.bundles
+			if err := q.Verify(); !errors.Is(err, ErrInvalidSignatures) {
+				t.Errorf("%v: unexpected error: %v", test.name, err)
+			}
+		}
+	})
+	t.Run("version", func(t *testing.T) {
+		t.Parallel()
+		p, _ := Generate(message, operators[:2], WithPolicy(policy))
+		p.Version = V1
+		if err := p.Verify(); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("failed to catch V1 payload with policy: %v", err)
+		}
+		p.Version, p.Policy = V2, nil
+		if err := p.Verify(); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("failed to catch V2 payload without policy: %v", err)
+		}
+	})
+}
+
+func TestPolicyValidate(t *testing.T) {
+	t.Parallel()
+
+	keys, err := SignerKeys([]sig.Signer{sig.GenNaclSign(), sig.GenNaclSign()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		policy Policy
+	}{
+		{"no keys", Policy{Threshold: 1}},
+		{"zero threshold", Policy{Threshold: 0, Keys: keys}},
+		{"threshold above keys", Policy{Threshold: 3, Keys: keys}},
+		{"duplicate key", Policy{Threshold: 1, Keys: []PolicyKey{keys[0], keys[0]}}},
+		{"unknown alg", Policy{Threshold: 1, Keys: []PolicyKey{{Alg: 0xffff, Pub: keys[0].Pub}}}},
+		{"pub size", Policy{Threshold: 1, Keys: []PolicyKey{{Alg: sig.AlgNaClSign, Pub: keys[0].Pub[1:]}}}},
+		{"too many keys", Policy{Threshold: 1, Keys: make([]PolicyKey, MaxPolicyKeys+1)}},
+	}
+	for _, test := range tests {
+		if err := test.policy.Validate(); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+		}
+	}
+	if _, err := NewPolicy(MaxSigBundleCount+1, keys); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
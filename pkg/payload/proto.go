@@ -0,0 +1,343 @@
+package payload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Format type is used for selecting the wire encoding of a Payload.
+type Format uint8
+
+const (
+	// FormatJSON is the JSON encoding with base64 encoded byte fields
+	FormatJSON Format = iota
+	// FormatProtobuf is the binary protobuf encoding described in payload.proto
+	FormatProtobuf
+)
+
+const (
+	// ContentTypeJSON is the media type for FormatJSON
+	ContentTypeJSON = "application/json"
+	// ContentTypeProtobuf is the media type for FormatProtobuf
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// field numbers from payload.proto
+const (
+	fieldVersion    protowire.Number = 1
+	fieldTimestamp  protowire.Number = 2
+	fieldTTL        protowire.Number = 3
+	fieldSigBundles protowire.Number = 4
+	fieldData       protowire.Number = 5
+	fieldPolicy     protowire.Number = 6
+	fieldSequence   protowire.Number = 7
+	fieldPrev       protowire.Number = 8
+
+	fieldBundleAlg protowire.Number = 1
+	fieldBundlePub protowire.Number = 2
+	fieldBundleSig protowire.Number = 3
+
+	fieldPolicyThreshold protowire.Number = 1
+	fieldPolicyKeys      protowire.Number = 2
+
+	fieldPolicyKeyAlg protowire.Number = 1
+	fieldPolicyKeyPub protowire.Number = 2
+)
+
+var errTimestampRange = errors.New("payload: timestamp out of range for unix nanoseconds")
+
+// ContentType returns the media type of a Format
+func (f Format) ContentType() string {
+	if f == FormatProtobuf {
+		return ContentTypeProtobuf
+	}
+	return ContentTypeJSON
+}
+
+// FormatFromContentType returns the Format for a Content-Type header value. Both
+// application/protobuf and application/x-protobuf select FormatProtobuf; anything
+// else, including an empty header, selects FormatJSON.
+func FormatFromContentType(ct string) Format {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return FormatJSON
+	}
+	switch mt {
+	case ContentTypeProtobuf, "application/x-protobuf":
+		return FormatProtobuf
+	}
+	return FormatJSON
+}
+
+// FormatFromAccept returns the Format for the first supported media type listed in
+// an Accept header value, defaulting to FormatJSON.
+func FormatFromAccept(accept string) Format {
+	for _, v := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case ContentTypeProtobuf, "application/x-protobuf":
+			return FormatProtobuf
+		case ContentTypeJSON:
+			return FormatJSON
+		}
+	}
+	return FormatJSON
+}
+
+// DetectFormat returns FormatJSON if b begins with a JSON object and FormatProtobuf
+// otherwise. A valid protobuf payload always begins with a field tag, never '{'.
+func DetectFormat(b []byte) Format {
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '{' {
+		return FormatJSON
+	}
+	return FormatProtobuf
+}
+
+// MarshalFormat takes a payload and returns it encoded in Format f
+func MarshalFormat(p Payload, f Format) ([]byte, error) {
+	if f == FormatProtobuf {
+		return MarshalProto(p)
+	}
+	return Marshal(p)
+}
+
+// UnmarshalFormat takes bytes encoded in Format f and returns a Payload and error
+func UnmarshalFormat(b []byte, f Format) (Payload, error) {
+	if f == FormatProtobuf {
+		return UnmarshalProto(b)
+	}
+	return Unmarshal(b)
+}
+
+// MarshalProto takes a payload and returns the protobuf encoding described in payload.proto
+func MarshalProto(p Payload) ([]byte, error) {
+	ts := p.Timestamp.UnixNano()
+	if !time.Unix(0, ts).Equal(p.Timestamp) {
+		return nil, errTimestampRange
+	}
+	var b []byte
+	b = protowire.AppendTag(b, fieldVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(p.Version))
+	b = protowire.AppendTag(b, fieldTimestamp, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(ts))
+	b = protowire.AppendTag(b, fieldTTL, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(p.TTL)))
+	for _, bundle := range p.SigBundles {
+		b = protowire.AppendTag(b, fieldSigBundles, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalProtoBundle(bundle))
+	}
+	b = protowire.AppendTag(b, fieldData, protowire.BytesType)
+	b = protowire.AppendBytes(b, p.Data)
+	if p.Policy != nil {
+		b = protowire.AppendTag(b, fieldPolicy, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalProtoPolicy(p.Policy))
+	}
+	if p.Sequence != 0 {
+		b = protowire.AppendTag(b, fieldSequence, protowire.VarintType)
+		b = protowire.AppendVarint(b, p.Sequence)
+	}
+	if len(p.Prev) != 0 {
+		b = protowire.AppendTag(b, fieldPrev, protowire.BytesType)
+		b = protowire.AppendBytes(b, p.Prev)
+	}
+	return b, nil
+}
+
+// marshalProtoPolicy returns the protobuf encoding of a Policy
+func marshalProtoPolicy(p *Policy) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, fieldPolicyThreshold, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(p.Threshold))
+	for _, k := range p.Keys {
+		var kb []byte
+		kb = protowire.AppendTag(kb, fieldPolicyKeyAlg, protowire.VarintType)
+		kb = protowire.AppendVarint(kb, uint64(k.Alg))
+		kb = protowire.AppendTag(kb, fieldPolicyKeyPub, protowire.BytesType)
+		kb = protowire.AppendBytes(kb, k.Pub)
+		b = protowire.AppendTag(b, fieldPolicyKeys, protowire.BytesType)
+		b = protowire.AppendBytes(b, kb)
+	}
+	return b
+}
+
+// marshalProtoBundle returns the protobuf encoding of a sig.Bundle
+func marshalProtoBundle(bundle sig.Bundle) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, fieldBundleAlg, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(bundle.Alg))
+	b = protowire.AppendTag(b, fieldBundlePub, protowire.BytesType)
+	b = protowire.AppendBytes(b, bundle.Pub)
+	b = protowire.AppendTag(b, fieldBundleSig, protowire.BytesType)
+	b = protowire.AppendBytes(b, bundle.Sig)
+	return b
+}
+
+// UnmarshalProto takes protobuf encoded bytes and returns a Payload and error.
+// Unknown fields are skipped.
+func UnmarshalProto(b []byte) (Payload, error) {
+	var p Payload
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch {
+		case num == fieldVersion && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			if x > uint64(^Version(0)) {
+				return n, errors.New("payload: version out of range")
+			}
+			p.Version = Version(x)
+			return n, nil
+		case num == fieldTimestamp && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			p.Timestamp = time.Unix(0, protowire.DecodeZigZag(x))
+			return n, nil
+		case num == fieldTTL && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			p.TTL = time.Duration(protowire.DecodeZigZag(x))
+			return n, nil
+		case num == fieldSigBundles && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(v)
+			if n < 0 {
+				return n, nil
+			}
+			bundle, err := unmarshalProtoBundle(x)
+			if err != nil {
+				return n, err
+			}
+			p.SigBundles = append(p.SigBundles, bundle)
+			return n, nil
+		case num == fieldData && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(v)
+			p.Data = append(Bytes{}, x...)
+			return n, nil
+		case num == fieldPolicy && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(v)
+			if n < 0 {
+				return n, nil
+			}
+			policy, err := unmarshalProtoPolicy(x)
+			if err != nil {
+				return n, err
+			}
+			p.Policy = policy
+			return n, nil
+		case num == fieldSequence && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			p.Sequence = x
+			return n, nil
+		case num == fieldPrev && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(v)
+			p.Prev = append(Bytes(nil), x...)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, v), nil
+	})
+	if err != nil {
+		return Payload{}, err
+	}
+	return p, nil
+}
+
+// unmarshalProtoBundle decodes a protobuf encoded sig.Bundle
+func unmarshalProtoBundle(b []byte) (sig.Bundle, error) {
+	var bundle sig.Bundle
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch {
+		case num == fieldBundleAlg && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			if x > uint64(^sig.Alg(0)) {
+				return n, errors.New("payload: alg out of range")
+			}
+			bundle.Alg = sig.Alg(x)
+			return n, nil
+		case num == fieldBundlePub && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(v)
+			bundle.Pub = append(sig.Bytes{}, x...)
+			return n, nil
+		case num == fieldBundleSig && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(v)
+			bundle.Sig = append(sig.Bytes{}, x...)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, v), nil
+	})
+	return bundle, err
+}
+
+// unmarshalProtoPolicy decodes a protobuf encoded Policy
+func unmarshalProtoPolicy(b []byte) (*Policy, error) {
+	var p Policy
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch {
+		case num == fieldPolicyThreshold && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			if x > uint64(^uint32(0)) {
+				return n, errors.New("payload: policy threshold out of range")
+			}
+			p.Threshold = uint32(x)
+			return n, nil
+		case num == fieldPolicyKeys && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(v)
+			if n < 0 {
+				return n, nil
+			}
+			var k PolicyKey
+			err := consumeFields(x, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+				switch {
+				case num == fieldPolicyKeyAlg && typ == protowire.VarintType:
+					x, n := protowire.ConsumeVarint(v)
+					if x > uint64(^sig.Alg(0)) {
+						return n, errors.New("payload: alg out of range")
+					}
+					k.Alg = sig.Alg(x)
+					return n, nil
+				case num == fieldPolicyKeyPub && typ == protowire.BytesType:
+					x, n := protowire.ConsumeBytes(v)
+					k.Pub = append(sig.Bytes{}, x...)
+					return n, nil
+				}
+				return protowire.ConsumeFieldValue(num, typ, v), nil
+			})
+			if err != nil {
+				return n, err
+			}
+			p.Keys = append(p.Keys, k)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, v), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// consumeFields walks the fields of a protobuf message, calling fn with the bytes
+// following each tag. fn returns the number of bytes consumed, or a negative
+// protowire error code.
+func consumeFields(b []byte, fn func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("payload: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		n, err := fn(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("payload: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	signers := []sig.Signer{sig.GenNaclSign(), sig.GenNaclSign()}
+	p, err := Generate([]byte("hello, world"), signers, WithTTL(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := MarshalProto(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) >= len(j) {
+		t.Errorf("protobuf: %v bytes, json: %v bytes, expected protobuf to be smaller", len(b), len(j))
+	}
+	o, err := UnmarshalProto(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.Timestamp.Equal(p.Timestamp) || o.TTL != p.TTL || o.Version != p.Version {
+		t.Errorf("header mismatch: %+v", o)
+	}
+	if !bytes.Equal(o.Data, p.Data) || !reflect.DeepEqual(o.SigBundles, p.SigBundles) {
+		t.Error("body mismatch")
+	}
+	if err := o.Verify(WithValidateFormat(FormatProtobuf)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProtoGolden(t *testing.T) {
+	t.Parallel()
+
+	p := Payload{
+		Version:    V1,
+		Timestamp:  time.Unix(0, 1),
+		TTL:        -1,
+		SigBundles: []sig.Bundle{{Alg: sig.AlgNaClSign, Pub: []byte{0xaa}, Sig: []byte{0xbb}}},
+		Data:       []byte("hi"),
+	}
+	expected := "080110021801220808011201aa1a01bb2a026869"
+	b, err := MarshalProto(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(b) != expected {
+		t.Errorf("actual: %x, expected: %v", b, expected)
+	}
+}
+
+func TestUnmarshalProto(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unknown fields are skipped", func(t *testing.T) {
+		b, _ := hex.DecodeString("0801")
+		b = protowire.AppendTag(b, 99, protowire.BytesType)
+		b = protowire.AppendBytes(b, []byte("future"))
+		p, err := UnmarshalProto(b)
+		if err != nil {
+			t.Error(err)
+		}
+		if p.Version != V1 {
+			t.Errorf("actual: %v, expected: %v", p.Version, V1)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		tests := []struct {
+			hex         string
+			description string
+		}{
+			{hex: "ffffffffffffff", description: "failed to catch malformed payload bytes"},
+			{hex: "2208080112", description: "failed to catch truncated bundle"},
+			{hex: "2a0568", description: "failed to catch truncated data"},
+			{hex: "0880800c", description: "failed to catch out of range version"},
+			{hex: "220408808004", description: "failed to catch out of range alg"},
+		}
+		for _, test := range tests {
+			b, _ := hex.DecodeString(test.hex)
+			if _, err := UnmarshalProto(b); err == nil {
+				t.Error(test.description)
+			}
+		}
+	})
+
+	t.Run("out of range timestamp", func(t *testing.T) {
+		p := Payload{Timestamp: time.Unix(-99999999999, 0)}
+		if _, err := MarshalProto(p); err == nil {
+			t.Error("failed to catch invalid timestamp")
+		}
+	})
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	contentTypes := map[string]Format{
+		"":                                  FormatJSON,
+		"application/json":                  FormatJSON,
+		"application/protobuf":              FormatProtobuf,
+		"application/x-protobuf; v=1":       FormatProtobuf,
+		"application/x-www-form-urlencoded": FormatJSON,
+	}
+	for ct, expected := range contentTypes {
+		if f := FormatFromContentType(ct); f != expected {
+			t.Errorf("content-type %q: actual: %v, expected: %v", ct, f, expected)
+		}
+	}
+	accepts := map[string]Format{
+		"":                                       FormatJSON,
+		"*/*":                                    FormatJSON,
+		"text/html, application/protobuf":        FormatProtobuf,
+		"application/json, application/protobuf": FormatJSON,
+	}
+	for a, expected := range accepts {
+		if f := FormatFromAccept(a); f != expected {
+			t.Errorf("accept %q: actual: %v, expected: %v", a, f, expected)
+		}
+	}
+	if DetectFormat([]byte(" {\"version\":1}")) != FormatJSON || DetectFormat([]byte{0x08, 0x01}) != FormatProtobuf {
+		t.Error("failed to detect format")
+	}
+	if FormatProtobuf.ContentType() != ContentTypeProtobuf || FormatJSON.ContentType() != ContentTypeJSON {
+		t.Error("content type mismatch")
+	}
+}
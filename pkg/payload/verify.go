@@ -13,7 +13,8 @@ const (
 	// allowed for a single payload
 	MaxSigBundleCount = 4
 	// MaxPayloadSize is intended to by used by a LimitedReader
-	// to enforce a strict upper limit on payload size
+	// to enforce a strict upper limit on payload size. It fits
+	// MaxSigBundleCount bundles of the largest registered sig Alg.
 	MaxPayloadSize = 128 * 1024 // 128 KB
 	// MaxMessageSize Payload.Data
 	MaxMessageSize = 512 // bytes
@@ -26,6 +27,21 @@ const (
 	MaxTTL = 24 * 7 * time.Hour // 1 week
 )
 
+// Errors returned by Verify for each validation and verification failure. Verify
+// wraps validation errors, so they should be matched with errors.Is.
+var (
+	ErrInvalidEndpoint   = errors.New("invalid endpoint")
+	ErrMaxPayloadSize    = errors.New("MaxPayloadSize exceeded")
+	ErrMaxMessageSize    = errors.New("MaxMessageSize exceeded")
+	ErrInvalidVersion    = errors.New("invalid payload version")
+	ErrExpired           = errors.New("payload ttl is expired")
+	ErrInvalidTTL        = errors.New("invalid payload ttl")
+	ErrInvalidTimestamp  = errors.New("invalid payload timestamp")
+	ErrFutureTimestamp   = errors.New("payload timestamp is too far in the future")
+	ErrSubmitWindow      = errors.New("timestamp is outside of submit window")
+	ErrInvalidSignatures = errors.New("failed signature verification")
+)
+
 // validateContext is used for interacting with options
 type validateContext struct {
 	endpoint      string
@@ -37,6 +53,7 @@ type validateContext struct {
 	submitTime    bool
 	futureTime    bool
 	referenceTime time.Time
+	format        Format
 }
 
 // WithValidateEndpoint sets the endpoint string for options.validate.endpoint and is
@@ -47,6 +64,15 @@ func WithValidateEndpoint(e string) Option {
 	}
 }
 
+// WithValidateFormat sets the wire Format for options.validate.format and is used by
+// the Verify method to measure payload size in the encoding that was actually
+// received. format defaults to FormatJSON.
+func WithValidateFormat(f Format) Option {
+	return func(o *options) {
+		o.validate.format = f
+	}
+}
+
 // WithReferenceTime sets time for options.validate.referenceTime and is used for
 // the Verify method. referenceTime defaults to time.Now
 func WithReferenceTime(t time.Time) Option {
@@ -123,16 +149,28 @@ func (p Payload) Verify(options ...Option) error {
 func verify(p Payload, options ...Option) error {
 
 	if err := validate(p, options...); err != nil {
-		return fmt.Errorf("validation error: %v", err)
+		return fmt.Errorf("validation error: %w", err)
 	}
 
-	if ok := p.VerifySignatures(); !ok {
-		return errors.New("failed signature verification")
+	if err := p.verifySignatures(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignatures, err)
 	}
 
 	return nil
 }
 
+// verifySignatures verifies every bundle of a payload, or the threshold Policy of
+// a threshold payload, and returns an error describing the first failure
+func (p Payload) verifySignatures() error {
+	if p.Version == V2 && p.Policy == nil {
+		return ErrInvalidPolicy
+	}
+	if p.isThreshold() {
+		return p.Policy.VerifyBundles(p.SigningBytes(), p.SigBundles)
+	}
+	return sigutil.VerifyBundles(p.SigningBytes(), p.SigBundles)
+}
+
 // validate takes a payload and set of options and validates
 // the payload itself. This ensures it meets size and version
 // requirements
@@ -141,43 +179,52 @@ func validate(p Payload, opts ...Option) error {
 
 	if o.validate.endpoint != "" {
 		if !p.ValidEndpoint(o.validate.endpoint) {
-			return errors.New("invalid endpoint")
+			return ErrInvalidEndpoint
 		}
 	}
 
 	if o.validate.payloadSize {
-		if !p.ValidPayloadSize() {
-			return errors.New("MaxPayloadSize exceeded")
+		if !p.ValidWireSize(o.validate.format) {
+			return ErrMaxPayloadSize
 		}
 	}
 	if o.validate.dataSize {
 		if !p.ValidDataSize() {
-			return errors.New("MaxMessageSize exceeded")
+			return ErrMaxMessageSize
 		}
 	}
 	if o.validate.version {
 		if !p.ValidVersion() {
-			return errors.New("invalid payload version")
+			return ErrInvalidVersion
 		}
 	}
+	if err := p.validPolicy(); err != nil {
+		return err
+	}
+	if err := p.validSigningInput(); err != nil {
+		return err
+	}
+	if err := p.validChain(); err != nil {
+		return err
+	}
 	if o.validate.expiration {
 		if p.IsExpired(o.validate.referenceTime) {
-			return errors.New("payload ttl is expired")
+			return ErrExpired
 		}
 	}
 	if o.validate.ttl {
 		if !p.ValidTTL() {
-			return errors.New("invalid payload ttl")
+			return ErrInvalidTTL
 		}
 	}
 	if o.validate.futureTime {
 		if p.IsInFuture(o.validate.referenceTime) {
-			return errors.New("payload timestamp is too far in the future")
+			return ErrFutureTimestamp
 		}
 	}
 	if o.validate.submitTime {
 		if !p.WithinSubmitWindow(o.validate.referenceTime) {
-			return errors.New("timestamp is outside of submit window")
+			return ErrSubmitWindow
 		}
 	}
 	return nil
@@ -207,26 +254,67 @@ func (p Payload) IsInFuture(t time.Time) bool {
 	return p.Timestamp.UnixNano() > t.Add(MaxSubmitWindow).UnixNano()
 }
 
+// validSigningInput checks that the timestamp and TTL of a V3 payload are encoded in
+// its SigningBytes without wrapping: a timestamp before 1970 or beyond the range of
+// unix nanoseconds and a negative TTL are rejected. V1 and V2 payloads are not
+// checked, so that their verification is unchanged.
+func (p Payload) validSigningInput() error {
+	if p.Version != V3 {
+		return nil
+	}
+	ts := p.Timestamp.UnixNano()
+	if ts < 0 || !time.Unix(0, ts).Equal(p.Timestamp) {
+		return fmt.Errorf("%w: %v is before 1970 or out of range", ErrInvalidTimestamp, p.Timestamp)
+	}
+	if p.TTL < 0 {
+		return fmt.Errorf("%w: %v is negative", ErrInvalidTTL, p.TTL)
+	}
+	return nil
+}
+
 // ValidVersion returns whether version is supported by Hashmap
-// Currently only V1 is supported.
+// Currently V1, V2 and V3 are supported.
 func (p Payload) ValidVersion() bool {
 	switch p.Version {
-	case V1:
+	case V1, V2, V3:
 		return true
 	}
 	return false
 }
 
+// validPolicy checks that V2 payloads carry a valid Policy and at most
+// MaxSigBundleCount bundles. V3 payloads may carry a Policy, other versions may not.
+func (p Payload) validPolicy() error {
+	switch {
+	case p.Version == V2 && p.Policy == nil:
+		return fmt.Errorf("%w: V2 payloads require a policy", ErrInvalidPolicy)
+	case p.Policy == nil:
+		return nil
+	case !p.isThreshold():
+		return fmt.Errorf("%w: only V2 and V3 payloads have a policy", ErrInvalidPolicy)
+	}
+	if len(p.SigBundles) > MaxSigBundleCount {
+		return fmt.Errorf("%w: %d signatures exceed %d", ErrInvalidPolicy, len(p.SigBundles), MaxSigBundleCount)
+	}
+	return p.Policy.Validate()
+}
+
 // ValidDataSize checks that the length of Payload.Data is less than or equal
 // to the MaxMessageSize and returns a boolean value.
 func (p Payload) ValidDataSize() bool {
 	return len(p.Data) <= MaxMessageSize
 }
 
-// ValidPayloadSize checks that the wire protocol bytes are less than or equal
+// ValidPayloadSize checks that the JSON wire protocol bytes are less than or equal
 // to the MaxPayloadSize allowed and returns a boolean value.
 func (p Payload) ValidPayloadSize() bool {
-	b, err := Marshal(p)
+	return p.ValidWireSize(FormatJSON)
+}
+
+// ValidWireSize checks that the payload encoded in Format f is less than or equal
+// to the MaxPayloadSize allowed and returns a boolean value.
+func (p Payload) ValidWireSize(f Format) bool {
+	b, err := MarshalFormat(p, f)
 	if err != nil {
 		return false
 	}
@@ -249,7 +337,7 @@ func (p Payload) WithinSubmitWindow(t time.Time) bool {
 }
 
 // VerifySignatures checks all signatures in the sigBundles. If all signatures
-// are valid, it returns `true`.
+// are valid, or for threshold payloads the Policy threshold is met, it returns `true`.
 func (p Payload) VerifySignatures() bool {
-	return sigutil.VerifyAll(p.SigningBytes(), p.SigBundles)
+	return p.verifySignatures() == nil
 }
@@ -2,6 +2,7 @@ package payload
 
 import (
 	"encoding/base64"
+	"errors"
 	"testing"
 	"time"
 
@@ -27,15 +28,15 @@ func TestVerify(t *testing.T) {
 			WithReferenceTime(now.Add(15*time.Second)),
 			WithServerMode(true),
 		)
-		if err == nil {
-			t.Error("Verify did not catch invalid payload")
+		if !errors.Is(err, ErrSubmitWindow) {
+			t.Errorf("Verify did not catch invalid payload, got: %v", err)
 		}
 	})
 	t.Run("Failed Verification", func(t *testing.T) {
 		p.SigBundles[0].Sig = []byte("bad_bytes")
 		err := p.Verify()
-		if err == nil {
-			t.Error("Verify did not catch invalid signature")
+		if !errors.Is(err, ErrInvalidSignatures) || !errors.Is(err, sig.ErrInvalidSignature) {
+			t.Errorf("Verify did not catch invalid signature, got: %v", err)
 		}
 	})
 }
@@ -121,10 +122,24 @@ func TestValidate(t *testing.T) {
 			t.Error(err)
 		}
 	})
+	t.Run("Payload Size By Format", func(t *testing.T) {
+		message := make([]byte, 100*1024)
+		p, _ := Generate(message, signers, WithTimestamp(now))
+		if err := validate(p,
+			WithValidateDataSize(false),
+			WithValidateFormat(FormatJSON)); err == nil {
+			t.Error("validate did not catch MaxPayloadSize for base64 encoded json")
+		}
+		if err := validate(p,
+			WithValidateDataSize(false),
+			WithValidateFormat(FormatProtobuf)); err != nil {
+			t.Error(err)
+		}
+	})
 	t.Run("Version", func(t *testing.T) {
 		p, _ := Generate(message, signers,
 			WithTimestamp(now),
-			WithVersion(Version(3)))
+			WithVersion(V3+1))
 		if err := validate(p, WithValidateVersion(true)); err == nil {
 			t.Error("validate did not catch bad version")
 		}
@@ -168,3 +183,41 @@ func TestValidate(t *testing.T) {
 		}
 	})
 }
+
+// TestMaxPayloadSizeAlgorithms checks that a payload with the maximum data and number
+// of signature bundles fits in MaxPayloadSize for every registered algorithm.
+func TestMaxPayloadSizeAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	for _, a := range sig.Algorithms() {
+		p := Payload{
+			Version:   V1,
+			Timestamp: time.Now(),
+			TTL:       DefaultTTL,
+			Data:      make([]byte, MaxMessageSize),
+		}
+		for i := 0; i < MaxSigBundleCount; i++ {
+			p.SigBundles = append(p.SigBundles, sig.Bundle{
+				Alg: a.Alg,
+				Pub: make([]byte, a.PubKeySize),
+				Sig: make([]byte, a.SigSize),
+			})
+		}
+		for _, f := range []Format{FormatJSON, FormatProtobuf} {
+			if !p.ValidWireSize(f) {
+				t.Errorf("%v: %v bundles exceed MaxPayloadSize for format %v", a.Name, MaxSigBundleCount, f)
+			}
+		}
+
+		p.Version = V2
+		p.Policy = &Policy{Threshold: MaxSigBundleCount}
+		for i := 0; i < MaxPolicyKeys; i++ {
+			p.Policy.Keys = append(p.Policy.Keys, PolicyKey{Alg: a.Alg, Pub: make([]byte, a.PubKeySize)})
+		}
+		for _, f := range []Format{FormatJSON, FormatProtobuf} {
+			if !p.ValidWireSize(f) {
+				t.Errorf("%v: %v bundles and %v policy keys exceed MaxPayloadSize for format %v", a.Name, MaxSigBundleCount, MaxPolicyKeys, f)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package agent is a local signing agent. An Agent holds signers, normally those
+// of a keyset, and signs messages for clients over a Unix socket, so that processes
+// that publish payloads never load private keys.
+//
+// The protocol is a sequence of request and response frames on a connection. Each
+// frame is a 4 byte big endian length followed by a JSON object of at most
+// MaxFrameSize bytes. A request has an op of "keys" or "sign".
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+// MaxFrameSize is the upper limit, in bytes, of a request or response frame
+const MaxFrameSize = 1024 * 1024
+
+// Request ops
+const (
+	opKeys = "keys"
+	opSign = "sign"
+)
+
+var (
+	// ErrKeyNotFound is returned when the agent does not hold the requested key
+	ErrKeyNotFound = errors.New("agent: key not found")
+	// ErrAgent is returned when the agent fails to sign
+	ErrAgent = errors.New("agent: signing failed")
+)
+
+// Key is the Alg and public key of a signer held by an Agent
+type Key struct {
+	Alg sig.Alg   `json:"alg"`
+	Pub sig.Bytes `json:"pub"`
+}
+
+// request is a keys or sign request. Key and Message are only set for sign.
+type request struct {
+	Op      string    `json:"op"`
+	Key     *Key      `json:"key,omitempty"`
+	Message sig.Bytes `json:"message,omitempty"`
+}
+
+// response is the response to a request. Error is set if the request failed.
+type response struct {
+	Keys   []Key       `json:"keys,omitempty"`
+	Bundle *sig.Bundle `json:"bundle,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	// NotFound is set with Error when the requested key is not held by the agent
+	NotFound bool `json:"not_found,omitempty"`
+}
+
+// Agent signs messages with its signers for clients. Signing is serialized, so that
+// stateful signers, such as XMSS keys in a sigutil.KeySetFile, are never used
+// concurrently.
+type Agent struct {
+	mu      sync.Mutex
+	signers []sig.Signer
+	keys    []Key
+}
+
+// New takes signers that implement sig.Keyer and returns an Agent for them
+func New(signers []sig.Signer) (*Agent, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("agent: at least one signer is required")
+	}
+	a := &Agent{signers: signers, keys: make([]Key, len(signers))}
+	for i, s := range signers {
+		k, ok := s.(sig.Keyer)
+		if !ok {
+			return nil, fmt.Errorf("agent: %T does not implement sig.Keyer", s)
+		}
+		a.keys[i] = Key{Alg: k.Alg(), Pub: k.PublicKey()}
+	}
+	return a, nil
+}
+
+// Listen creates a Unix socket at path that only the current user can connect to.
+// The directory of path must be owned by the current user and not be accessible by
+// other users, so that the socket can not be pre-created or reached before its
+// permissions are set. The socket file is removed when the listener is closed.
+func Listen(path string) (net.Listener, error) {
+	if err := checkPrivateDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts connections on l and serves each one in a new goroutine until l is
+// closed, when it returns nil.
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go a.ServeConn(c)
+	}
+}
+
+// ServeConn serves requests on a single connection until it is closed by the client
+// or a malformed frame is read, and then closes it.
+func (a *Agent) ServeConn(c net.Conn) {
+	defer c.Close()
+	for {
+		var req request
+		if err := readFrame(c, &req); err != nil {
+			return
+		}
+		if err := writeFrame(c, a.handle(req)); err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the response to a request
+func (a *Agent) handle(req request) response {
+	switch req.Op {
+	case opKeys:
+		return response{Keys: a.keys}
+	case opSign:
+		if req.Key == nil {
+			return response{Error: "sign request has no key"}
+		}
+		s := a.signer(*req.Key)
+		if s == nil {
+			return response{Error: fmt.Sprintf("no %v key %x", req.Key.Alg, []byte(req.Key.Pub)), NotFound: true}
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		b, err := s.Sign(req.Message)
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		return response{Bundle: &b}
+	}
+	return response{Error: fmt.Sprintf("unknown op: %q", req.Op)}
+}
+
+// signer returns the signer for a key, or nil
+func (a *Agent) signer(k Key) sig.Signer {
+	for i, key := range a.keys {
+		if key.Alg == k.Alg && bytes.Equal(key.Pub, k.Pub) {
+			return a.signers[i]
+		}
+	}
+	return nil
+}
+
+// writeFrame writes the JSON encoding of v as a length prefixed frame
+func writeFrame(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxFrameSize {
+		return fmt.Errorf("agent: frame of %d bytes exceeds %d", len(b), MaxFrameSize)
+	}
+	f := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(f, uint32(len(b)))
+	_, err = w.Write(append(f, b...))
+	return err
+}
+
+// readFrame reads a length prefixed frame and decodes its JSON into v
+func readFrame(r io.Reader, v interface{}) error {
+	var h [4]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(h[:])
+	if n > MaxFrameSize {
+		return fmt.Errorf("agent: frame of %d bytes exceeds %d", n, MaxFrameSize)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
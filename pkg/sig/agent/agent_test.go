@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+// blockingSigner is a sig.Signer whose Sign blocks until release is closed
+type blockingSigner struct {
+	*sig.NaClSign
+	release chan struct{}
+}
+
+func (s *blockingSigner) Sign(message []byte) (sig.Bundle, error) {
+	<-s.release
+	return s.NaClSign.Sign(message)
+}
+
+// privateDir returns a temporary directory only accessible by the current user
+func privateDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// serve starts an agent for signers on a new socket and returns its path
+func serve(t *testing.T, signers ...sig.Signer) string {
+	t.Helper()
+	a, err := New(signers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(privateDir(t), "agent.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go a.Serve(l)
+	return path
+}
+
+func TestAgent(t *testing.T) {
+	t.Parallel()
+
+	m := []byte("sign me, plz.")
+	ctx := context.Background()
+
+	t.Run("signers", func(t *testing.T) {
+		t.Parallel()
+		local := []sig.Signer{sig.GenNaclSign(), sig.GenECDSAP256()}
+		c, err := Dial(ctx, serve(t, local...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		signers, err := c.Signers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(signers) != len(local) {
+			t.Fatalf("actual: %v signers, expected: %v", len(signers), len(local))
+		}
+		for i, s := range signers {
+			k := local[i].(sig.Keyer)
+			if s.(sig.Keyer).Alg() != k.Alg() || !bytes.Equal(s.(sig.Keyer).PublicKey(), k.PublicKey()) {
+				t.Errorf("signer %d key mismatch", i)
+			}
+			b, err := sig.SignContext(ctx, s, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sig.VerifyBundle(m, b); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	t.Run("unknown key", func(t *testing.T) {
+		t.Parallel()
+		c, err := Dial(ctx, serve(t, sig.GenNaclSign()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		other := sig.GenNaclSign()
+		_, err = c.Sign(ctx, Key{Alg: other.Alg(), Pub: other.PublicKey()}, m)
+		if !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := c.Keys(ctx); err != nil {
+			t.Errorf("connection unusable after error: %v", err)
+		}
+	})
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+		s := &blockingSigner{NaClSign: sig.GenNaclSign(), release: make(chan struct{})}
+		defer close(s.release)
+		c, err := Dial(ctx, serve(t, s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		signers, err := c.Signers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if _, err := sig.SignContext(tctx, signers[0], m); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := c.Keys(ctx); err == nil {
+			t.Error("interrupted connection was reused")
+		}
+	})
+	t.Run("oversized frame", func(t *testing.T) {
+		t.Parallel()
+		conn, err := net.Dial("unix", serve(t, sig.GenNaclSign()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		var h [4]byte
+		binary.BigEndian.PutUint32(h[:], MaxFrameSize+1)
+		conn.Write(h[:])
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(h[:]); err != io.EOF {
+			t.Errorf("connection not closed: %v", err)
+		}
+	})
+	t.Run("no signers", func(t *testing.T) {
+		t.Parallel()
+		if _, err := New(nil); err == nil {
+			t.Error("agent without signers")
+		}
+	})
+}
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+
+	dir := privateDir(t)
+	path := filepath.Join(dir, "agent.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions: %v, expected: 0600", perm)
+	}
+	l.Close()
+
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(path); err == nil {
+		t.Error("failed to refuse a directory accessible by other users")
+	}
+}
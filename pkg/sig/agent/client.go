@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+// Client is a connection to an Agent. It is safe for concurrent use, requests are
+// sent one at a time.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	err  error
+}
+
+// Dial connects to the agent listening on the Unix socket at path
+func Dial(ctx context.Context, path string) (*Client, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: c}, nil
+}
+
+// Close closes the connection to the agent
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// roundTrip sends a request and reads its response. A request interrupted by ctx
+// leaves the connection out of sync, so it is closed and later requests fail.
+func (c *Client) roundTrip(ctx context.Context, req request) (response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return response{}, c.err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	var resp response
+	err := writeFrame(c.conn, req)
+	if err == nil {
+		err = readFrame(c.conn, &resp)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.err = fmt.Errorf("agent: connection closed after error: %w", err)
+		c.conn.Close()
+		return response{}, err
+	}
+	if resp.NotFound {
+		return response{}, fmt.Errorf("%w: %s", ErrKeyNotFound, resp.Error)
+	}
+	if resp.Error != "" {
+		return response{}, fmt.Errorf("%w: %s", ErrAgent, resp.Error)
+	}
+	return resp, nil
+}
+
+// Keys returns the keys held by the agent, in the order of its signers
+func (c *Client) Keys(ctx context.Context) ([]Key, error) {
+	resp, err := c.roundTrip(ctx, request{Op: opKeys})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Sign asks the agent to sign message with key k. The returned Bundle is verified
+// before it is returned.
+func (c *Client) Sign(ctx context.Context, k Key, message []byte) (sig.Bundle, error) {
+	resp, err := c.roundTrip(ctx, request{Op: opSign, Key: &k, Message: message})
+	if err != nil {
+		return sig.Bundle{}, err
+	}
+	if resp.Bundle == nil {
+		return sig.Bundle{}, errors.New("agent: sign response has no bundle")
+	}
+	b := *resp.Bundle
+	if b.Alg != k.Alg || !bytes.Equal(b.Pub, k.Pub) {
+		return sig.Bundle{}, fmt.Errorf("agent: signed with %v key %x, expected %v key %x", b.Alg, []byte(b.Pub), k.Alg, []byte(k.Pub))
+	}
+	if err := sig.VerifyBundle(message, b); err != nil {
+		return sig.Bundle{}, fmt.Errorf("agent: %w", err)
+	}
+	return b, nil
+}
+
+// Signers returns a sig.Signer for each key held by the agent, in order. The signers
+// implement sig.ContextSigner and sig.Keyer and sign through the Client, so they can
+// not be used after it is closed.
+func (c *Client) Signers(ctx context.Context) ([]sig.Signer, error) {
+	keys, err := c.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signers := make([]sig.Signer, len(keys))
+	for i, k := range keys {
+		signers[i] = &remoteSigner{client: c, key: k}
+	}
+	return signers, nil
+}
+
+// remoteSigner is a sig.Signer for a key held by an agent
+type remoteSigner struct {
+	client *Client
+	key    Key
+}
+
+// Alg returns the Alg of the agent key
+func (s *remoteSigner) Alg() sig.Alg {
+	return s.key.Alg
+}
+
+// PublicKey returns the public key of the agent key
+func (s *remoteSigner) PublicKey() []byte {
+	return append([]byte{}, s.key.Pub...)
+}
+
+// Sign asks the agent to sign a message
+func (s *remoteSigner) Sign(message []byte) (sig.Bundle, error) {
+	return s.SignContext(context.Background(), message)
+}
+
+// SignContext asks the agent to sign a message, and stops waiting when ctx is done
+func (s *remoteSigner) SignContext(ctx context.Context, message []byte) (sig.Bundle, error) {
+	return s.client.Sign(ctx, s.key, message)
+}
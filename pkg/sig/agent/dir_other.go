@@ -0,0 +1,8 @@
+//go:build !unix
+
+package agent
+
+// checkPrivateDir is a no-op on platforms without Unix file ownership
+func checkPrivateDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPrivateDir returns an error if dir is not a directory owned by the current
+// user without group or other permissions
+func checkPrivateDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || !ok || int(st.Uid) != os.Getuid() || fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("agent: socket directory %v must be owned by the current user and only accessible by them", dir)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package sig
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedCryptoSigner is returned by NewCryptoSigner for a crypto.Signer whose
+// public key is not an ed25519 or P-256 key
+var ErrUnsupportedCryptoSigner = errors.New("sig: unsupported crypto.Signer, expected an ed25519 or ecdsa P-256 key")
+
+// CryptoSigner adapts a crypto.Signer, such as an ed25519.PrivateKey or a key held by
+// an HSM, smart card or cloud KMS, to the Signer interface. The private key never
+// has to be exported: ed25519 keys sign as AlgNaClSign and P-256 keys sign the
+// SHA-256 digest of a message as AlgECDSAP256. ECDSA signatures made through a
+// crypto.Signer are not necessarily deterministic, but verify the same way.
+type CryptoSigner struct {
+	signer crypto.Signer
+	alg    Alg
+	pub    []byte
+}
+
+// NewCryptoSigner takes a crypto.Signer and returns a CryptoSigner for its key
+func NewCryptoSigner(s crypto.Signer) (*CryptoSigner, error) {
+	switch pub := s.Public().(type) {
+	case ed25519.PublicKey:
+		return &CryptoSigner{signer: s, alg: AlgNaClSign, pub: append([]byte{}, pub...)}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ecdsa curve %v", ErrUnsupportedCryptoSigner, pub.Curve.Params().Name)
+		}
+		return &CryptoSigner{signer: s, alg: AlgECDSAP256, pub: elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y)}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedCryptoSigner, s.Public())
+}
+
+// Alg returns AlgNaClSign for an ed25519 key or AlgECDSAP256 for a P-256 key
+func (s *CryptoSigner) Alg() Alg {
+	return s.alg
+}
+
+// PublicKey returns the public key in the encoding of a Bundle
+func (s *CryptoSigner) PublicKey() []byte {
+	return append([]byte{}, s.pub...)
+}
+
+// Sign signs a message with the crypto.Signer and returns a Bundle
+func (s *CryptoSigner) Sign(message []byte) (Bundle, error) {
+	return s.SignContext(context.Background(), message)
+}
+
+// SignContext implements ContextSigner. crypto.Signer can not be canceled, so ctx is
+// only checked before signing.
+func (s *CryptoSigner) SignContext(ctx context.Context, message []byte) (Bundle, error) {
+	if err := ctx.Err(); err != nil {
+		return Bundle{}, err
+	}
+	var sig []byte
+	var err error
+	switch s.alg {
+	case AlgNaClSign:
+		sig, err = s.signer.Sign(rand.Reader, message, crypto.Hash(0))
+	case AlgECDSAP256:
+		digest := sha256.Sum256(message)
+		var der []byte
+		if der, err = s.signer.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+			sig, err = ecdsaFixedSig(der)
+		}
+	}
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	b := Bundle{
+		Alg: s.alg,
+		Pub: s.PublicKey(),
+		Sig: sig,
+	}
+
+	if err := VerifyBundle(message, b); err != nil {
+		return Bundle{}, fmt.Errorf("verification sanity check failed on sign: %w", err)
+	}
+
+	return b, nil
+}
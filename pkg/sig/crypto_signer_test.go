@@ -0,0 +1,79 @@
+package sig
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestCryptoSigner(t *testing.T) {
+	t.Parallel()
+
+	m := []byte("sign me, plz.")
+
+	t.Run("ed25519", func(t *testing.T) {
+		t.Parallel()
+		_, k, _ := ed25519.GenerateKey(rand.Reader)
+		s, err := NewCryptoSigner(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := NewNaClSignFromSeed(k.Seed())
+		if s.Alg() != AlgNaClSign || !bytes.Equal(s.PublicKey(), n.PublicKey()) {
+			t.Errorf("unexpected key: %v %x", s.Alg(), s.PublicKey())
+		}
+		b, err := s.Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := n.Sign(m)
+		if !bytes.Equal(b.Sig, expected.Sig) {
+			t.Error("signature differs from NaClSign")
+		}
+	})
+	t.Run("ecdsa p256", func(t *testing.T) {
+		t.Parallel()
+		k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		s, err := NewCryptoSigner(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var d [32]byte
+		k.D.FillBytes(d[:])
+		if s.Alg() != AlgECDSAP256 || !bytes.Equal(s.PublicKey(), NewECDSAP256(d[:]).PublicKey()) {
+			t.Errorf("unexpected key: %v %x", s.Alg(), s.PublicKey())
+		}
+		b, err := s.Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyBundle(m, b); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("unsupported curve", func(t *testing.T) {
+		t.Parallel()
+		k, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		if _, err := NewCryptoSigner(k); !errors.Is(err, ErrUnsupportedCryptoSigner) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+		_, k, _ := ed25519.GenerateKey(rand.Reader)
+		s, _ := NewCryptoSigner(k)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := SignContext(ctx, s, m); !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := SignContext(ctx, GenNaclSign(), m); !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected error for Signer: %v", err)
+		}
+	})
+}
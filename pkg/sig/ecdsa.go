@@ -0,0 +1,166 @@
+package sig
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// ecdsaP256PubKeySize is the size of a SEC 1 compressed P-256 point
+const ecdsaP256PubKeySize = 33
+
+// ecdsaSigSize is the size of a fixed width r|s ECDSA signature for 256 bit curves
+const ecdsaSigSize = 64
+
+// p256HalfOrder is half the order of P-256, the largest S of a low-S signature
+var p256HalfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+func init() {
+	marshal, unmarshal := keyCodec("ecdsa_p256_sha256", 32,
+		func(s *ECDSAP256) []byte { return append([]byte{}, s.prv[:]...) },
+		func(b []byte) *ECDSAP256 { return NewECDSAP256(b) },
+	)
+	MustRegister(Algorithm{
+		Alg:          AlgECDSAP256,
+		Name:         "ecdsa_p256_sha256",
+		PubKeySize:   ecdsaP256PubKeySize,
+		SigSize:      ecdsaSigSize,
+		Verify:       VerifyECDSAP256,
+		Key:          &ECDSAP256{},
+		Gen:          func() Signer { return GenECDSAP256() },
+		MarshalKey:   marshal,
+		UnmarshalKey: unmarshal,
+	})
+}
+
+// ECDSAP256 holds a 32 byte P-256 private scalar. It implements the Signer interface
+// with deterministic RFC 6979, low-S, signatures of the SHA-256 digest of a message.
+type ECDSAP256 struct {
+	prv [32]byte
+}
+
+// GenECDSAP256 returns a randomly generated P-256 private key in an ECDSAP256
+func GenECDSAP256() *ECDSAP256 {
+	k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var pk [32]byte
+	k.D.FillBytes(pk[:])
+	return &ECDSAP256{prv: pk}
+}
+
+// NewECDSAP256 takes a 32 byte big endian P-256 private scalar, such as one exported
+// from an HSM, and returns an ECDSAP256
+func NewECDSAP256(privateKey []byte) *ECDSAP256 {
+	var pk [32]byte
+	copy(pk[:], privateKey)
+	return &ECDSAP256{prv: pk}
+}
+
+// Alg returns AlgECDSAP256
+func (s *ECDSAP256) Alg() Alg {
+	return AlgECDSAP256
+}
+
+// PublicKey returns the 33 byte SEC 1 compressed public key, or nil if the private
+// scalar is invalid.
+func (s *ECDSAP256) PublicKey() []byte {
+	k, err := s.key()
+	if err != nil {
+		return nil
+	}
+	return elliptic.MarshalCompressed(elliptic.P256(), k.X, k.Y)
+}
+
+// key returns the ecdsa.PrivateKey for the private scalar
+func (s *ECDSAP256) key() (*ecdsa.PrivateKey, error) {
+	k, err := ecdh.P256().NewPrivateKey(s.prv[:])
+	if err != nil {
+		return nil, err
+	}
+	pub := k.PublicKey().Bytes() // 0x04|x|y
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(s.prv[:]),
+	}, nil
+}
+
+// Sign takes a message and returns a Bundle with a deterministic 64 byte r|s signature
+// of the SHA-256 digest of the message.
+func (s *ECDSAP256) Sign(message []byte) (Bundle, error) {
+	k, err := s.key()
+	if err != nil {
+		return Bundle{}, err
+	}
+	digest := sha256.Sum256(message)
+	der, err := k.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		return Bundle{}, err
+	}
+	sig, err := ecdsaFixedSig(der)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	b := Bundle{
+		Alg: AlgECDSAP256,
+		Pub: elliptic.MarshalCompressed(elliptic.P256(), k.X, k.Y),
+		Sig: sig,
+	}
+
+	if ok := VerifyECDSAP256(message, b); !ok {
+		return Bundle{}, errors.New("verification sanity check failed on sign")
+	}
+
+	return b, nil
+}
+
+// ecdsaFixedSig converts an ASN.1 DER P-256 ECDSA signature to the fixed width r|s
+// encoding used in a Bundle. S is normalized to n-S if it is above n/2, so that a
+// signature can not be changed into a second valid one.
+func ecdsaFixedSig(der []byte) ([]byte, error) {
+	var rs struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &rs)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 || rs.R.Sign() <= 0 || rs.S.Sign() <= 0 || rs.R.BitLen() > 256 || rs.S.BitLen() > 256 {
+		return nil, errors.New("sig: malformed ecdsa signature")
+	}
+	if rs.S.Cmp(p256HalfOrder) > 0 {
+		rs.S.Sub(elliptic.P256().Params().N, rs.S)
+	}
+	sig := make([]byte, ecdsaSigSize)
+	rs.R.FillBytes(sig[:32])
+	rs.S.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// VerifyECDSAP256 takes a message and a Bundle and returns a bool indicating if the
+// message is verified by the r|s signature and compressed public key. Signatures with
+// an S above n/2 are rejected.
+func VerifyECDSAP256(msg []byte, b Bundle) bool {
+	if len(b.Sig) != ecdsaSigSize {
+		return false
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), b.Pub)
+	if x == nil {
+		return false
+	}
+	digest := sha256.Sum256(msg)
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	r := new(big.Int).SetBytes(b.Sig[:32])
+	s := new(big.Int).SetBytes(b.Sig[32:])
+	if s.Cmp(p256HalfOrder) > 0 {
+		return false
+	}
+	return ecdsa.Verify(pub, digest[:], r, s)
+}
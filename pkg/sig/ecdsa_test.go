@@ -0,0 +1,82 @@
+package sig
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestECDSAP256(t *testing.T) {
+	t.Parallel()
+
+	m := []byte("sign me, plz.")
+
+	t.Run("deterministic", func(t *testing.T) {
+		t.Parallel()
+		s := GenECDSAP256()
+		b1, err := s.Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b2, err := s.Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b1.Sig, b2.Sig) {
+			t.Error("signatures are not deterministic")
+		}
+		if len(b1.Pub) != ecdsaP256PubKeySize || !bytes.Equal(b1.Pub, s.PublicKey()) {
+			t.Errorf("unexpected public key: %x", b1.Pub)
+		}
+		if !Verify(m, b1) {
+			t.Error("verification failed")
+		}
+		if Verify([]byte("other"), b1) {
+			t.Error("verified the wrong message")
+		}
+	})
+	t.Run("rfc6979 vector", func(t *testing.T) {
+		t.Parallel()
+		// RFC 6979 A.2.5, P-256 with SHA-256 and the message "sample", with the
+		// high S of the vector normalized to n-S
+		k, _ := hex.DecodeString("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+		b, err := NewECDSAP256(k).Sign([]byte("sample"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716" +
+			"0834e36ad29a83bf2bc9385e491d6099c8fdf9d1ed67aa7ea5f51f93782857a9"
+		if hex.EncodeToString(b.Sig) != expected {
+			t.Errorf("actual: %x, expected: %v", b.Sig, expected)
+		}
+	})
+	t.Run("high S", func(t *testing.T) {
+		t.Parallel()
+		b, err := GenECDSAP256().Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := new(big.Int).SetBytes(b.Sig[32:])
+		if s.Cmp(p256HalfOrder) > 0 {
+			t.Error("signature is not low-S")
+		}
+		s.Sub(elliptic.P256().Params().N, s)
+		flipped := Bundle{Alg: b.Alg, Pub: b.Pub, Sig: append(append(Bytes{}, b.Sig[:32]...), s.FillBytes(make([]byte, 32))...)}
+		if err := VerifyBundle(m, flipped); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("flipped S not rejected: %v", err)
+		}
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		t.Parallel()
+		s := NewECDSAP256(make([]byte, 32))
+		if _, err := s.Sign(m); err == nil {
+			t.Error("invalid key not caught")
+		}
+		if s.PublicKey() != nil {
+			t.Error("public key for invalid key")
+		}
+	})
+}
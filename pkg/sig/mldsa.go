@@ -0,0 +1,94 @@
+package sig
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+)
+
+func init() {
+	marshal, unmarshal := keyCodec("ml_dsa_65", mldsa65.SeedSize,
+		func(s *MLDSA65) []byte { return append([]byte{}, s.seed[:]...) },
+		func(b []byte) *MLDSA65 { return NewMLDSA65(b) },
+	)
+	MustRegister(Algorithm{
+		Alg:          AlgMLDSA65,
+		Name:         "ml_dsa_65",
+		PubKeySize:   mldsa65.PublicKeySize,
+		SigSize:      mldsa65.SignatureSize,
+		PQR:          true,
+		Verify:       VerifyMLDSA65,
+		Key:          &MLDSA65{},
+		Gen:          func() Signer { return GenMLDSA65() },
+		MarshalKey:   marshal,
+		UnmarshalKey: unmarshal,
+	})
+}
+
+// MLDSA65 holds the 32 byte seed of an ML-DSA-65 (FIPS 204) key pair. It implements
+// the Signer interface. Unlike XMSS, ML-DSA is stateless, so a key can sign any number
+// of messages and a keyset holding one does not need to be written back after signing.
+type MLDSA65 struct {
+	seed [mldsa65.SeedSize]byte
+}
+
+// GenMLDSA65 returns a randomly generated ML-DSA-65 seed in an MLDSA65
+func GenMLDSA65() *MLDSA65 {
+	var seed [mldsa65.SeedSize]byte
+	rand.Read(seed[:])
+	return &MLDSA65{seed: seed}
+}
+
+// NewMLDSA65 takes a 32 byte ML-DSA-65 seed and returns an MLDSA65
+func NewMLDSA65(seed []byte) *MLDSA65 {
+	var s [mldsa65.SeedSize]byte
+	copy(s[:], seed)
+	return &MLDSA65{seed: s}
+}
+
+// Alg returns AlgMLDSA65
+func (s *MLDSA65) Alg() Alg {
+	return AlgMLDSA65
+}
+
+// PublicKey returns the 1952 byte packed ML-DSA-65 public key
+func (s *MLDSA65) PublicKey() []byte {
+	pk, _ := mldsa65.NewKeyFromSeed(&s.seed)
+	return pk.Bytes()
+}
+
+// Sign takes a message and returns a Bundle with a hedged, randomized, ML-DSA-65
+// signature with an empty context string.
+func (s *MLDSA65) Sign(message []byte) (Bundle, error) {
+	pk, sk := mldsa65.NewKeyFromSeed(&s.seed)
+	sig := make([]byte, mldsa65.SignatureSize)
+	if err := mldsa65.SignTo(sk, message, nil, true, sig); err != nil {
+		return Bundle{}, err
+	}
+
+	b := Bundle{
+		Alg: AlgMLDSA65,
+		Pub: pk.Bytes(),
+		Sig: sig,
+	}
+
+	if ok := VerifyMLDSA65(message, b); !ok {
+		return Bundle{}, errors.New("verification sanity check failed on sign")
+	}
+
+	return b, nil
+}
+
+// VerifyMLDSA65 takes a message and a Bundle and returns a bool indicating if the
+// message is verified by the signature.
+func VerifyMLDSA65(msg []byte, b Bundle) bool {
+	if len(b.Pub) != mldsa65.PublicKeySize || len(b.Sig) != mldsa65.SignatureSize {
+		return false
+	}
+	var pk mldsa65.PublicKey
+	if err := pk.UnmarshalBinary(b.Pub); err != nil {
+		return false
+	}
+	return mldsa65.Verify(&pk, msg, nil, b.Sig)
+}
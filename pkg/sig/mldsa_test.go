@@ -0,0 +1,33 @@
+package sig
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMLDSA65(t *testing.T) {
+	t.Parallel()
+
+	m := []byte("sign me, plz.")
+	s := GenMLDSA65()
+	b, err := s.Sign(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Pub, s.PublicKey()) {
+		t.Error("signed public key mismatch")
+	}
+	if !Verify(m, b) {
+		t.Error("verification failed")
+	}
+	if Verify([]byte("other"), b) {
+		t.Error("verified the wrong message")
+	}
+	if !bytes.Equal(NewMLDSA65(s.seed[:]).PublicKey(), b.Pub) {
+		t.Error("seed does not reproduce the public key")
+	}
+	b.Sig[0] ^= 0xff
+	if Verify(m, b) {
+		t.Error("modified signature verified")
+	}
+}
@@ -1,15 +1,37 @@
 package sig
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"errors"
+	"fmt"
 
 	"golang.org/x/crypto/nacl/sign"
 )
 
+func init() {
+	marshal, unmarshal := keyCodec("nacl_sign", 64,
+		func(s *NaClSign) []byte { return append([]byte{}, s.PrivateKey[:]...) },
+		func(b []byte) *NaClSign { return NewNaClSign(b) },
+	)
+	MustRegister(Algorithm{
+		Alg:          AlgNaClSign,
+		Name:         "nacl_sign",
+		PubKeySize:   32,
+		SigSize:      sign.Overhead,
+		Verify:       VerifyNaclSign,
+		Key:          &NaClSign{},
+		Gen:          func() Signer { return GenNaclSign() },
+		MarshalKey:   marshal,
+		UnmarshalKey: unmarshal,
+	})
+}
+
 // NaClSign holds a pointer to a 64 byte array used by NaCl Sign. It implements the
 // Signer interface.
 type NaClSign struct {
+	// Deprecated: PrivateKey is only exported so that keysets encoded with gob by
+	// earlier versions can be decoded. Use MarshalKey or Seed to read the private key.
 	PrivateKey [64]byte
 }
 
@@ -28,10 +50,37 @@ func NewNaClSign(privateKey []byte) *NaClSign {
 	}
 }
 
-// Sign takes a message and returns a Bundle signed with a private key using NaCl Sign.
-func (s *NaClSign) Sign(message []byte) (Bundle, error) {
+// NewNaClSignFromSeed takes a 32 byte ed25519 seed, the private key form of RFC 8032
+// and crypto/ed25519, and returns a NaClSign
+func NewNaClSignFromSeed(seed []byte) (*NaClSign, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("sig: ed25519 seed is %d bytes, expected %d", len(seed), ed25519.SeedSize)
+	}
+	return NewNaClSign(ed25519.NewKeyFromSeed(seed)), nil
+}
+
+// Seed returns the 32 byte ed25519 seed of the private key
+func (s *NaClSign) Seed() []byte {
+	seed := make([]byte, ed25519.SeedSize)
+	copy(seed, s.PrivateKey[:ed25519.SeedSize])
+	return seed
+}
+
+// Alg returns AlgNaClSign
+func (s *NaClSign) Alg() Alg {
+	return AlgNaClSign
+}
+
+// PublicKey returns the 32 byte ed25519 public key.
+func (s *NaClSign) PublicKey() []byte {
 	pub := make([]byte, 32)
 	copy(pub, s.PrivateKey[32:])
+	return pub
+}
+
+// Sign takes a message and returns a Bundle signed with a private key using NaCl Sign.
+func (s *NaClSign) Sign(message []byte) (Bundle, error) {
+	pub := s.PublicKey()
 
 	sig := sign.Sign(nil, message, &s.PrivateKey)
 
@@ -24,3 +24,19 @@ func TestSign(t *testing.T) {
 		}
 	})
 }
+
+func TestNewNaClSignFromSeed(t *testing.T) {
+	t.Parallel()
+
+	s := GenNaclSign()
+	n, err := NewNaClSignFromSeed(s.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.PrivateKey != s.PrivateKey {
+		t.Error("private key mismatch")
+	}
+	if _, err := NewNaClSignFromSeed(s.PrivateKey[:]); err == nil {
+		t.Error("failed to catch invalid seed size")
+	}
+}
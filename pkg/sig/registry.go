@@ -0,0 +1,202 @@
+package sig
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnknownAlg is returned for an Alg that has not been registered
+	ErrUnknownAlg = errors.New("sig: unknown algorithm")
+	// ErrInvalidSignature is returned by VerifyBundle when a Bundle does not verify
+	ErrInvalidSignature = errors.New("sig: invalid signature")
+)
+
+// Algorithm describes a signature algorithm. Each algorithm registers itself with
+// Register, normally from an init func, and the registry is consulted by Verify,
+// by keyset encoding in sigutil and by anything that describes an Alg.
+type Algorithm struct {
+	// Alg is the wire identifier of the algorithm. 0 is reserved.
+	Alg Alg
+	// Name is the unique human readable name, such as nacl_sign
+	Name string
+	// PubKeySize and SigSize are the exact sizes, in bytes, of the Pub and Sig of
+	// a Bundle. A size of 0 is not checked.
+	PubKeySize int
+	SigSize    int
+	// PQR is true if the algorithm is considered post-quantum resistant
+	PQR bool
+	// Verify reports whether a Bundle with correctly sized Pub and Sig is a valid
+	// signature of message
+	Verify func(message []byte, b Bundle) bool
+	// Key is an optional value of the algorithm's Signer type. It is registered
+	// with encoding/gob so that keysets containing the Signer can be decoded.
+	Key Signer
+	// Gen optionally returns a new randomly generated Signer for keyset generation
+	Gen func() Signer
+	// MarshalKey and UnmarshalKey convert a Signer to and from the private key bytes
+	// stored in keyset files. The bytes of a stateful Signer include its state.
+	MarshalKey   func(Signer) ([]byte, error)
+	UnmarshalKey func([]byte) (Signer, error)
+}
+
+// registry holds the registered Algorithms by Alg and by name
+var registry = struct {
+	sync.RWMutex
+	algs  map[Alg]Algorithm
+	names map[string]Alg
+}{
+	algs:  make(map[Alg]Algorithm),
+	names: make(map[string]Alg),
+}
+
+// Register adds an Algorithm to the registry. It returns an error if the Alg or
+// Name is empty or already registered, or if Verify is nil.
+func Register(a Algorithm) error {
+	switch {
+	case a.Alg == 0:
+		return errors.New("sig: Alg 0 is reserved")
+	case a.Name == "":
+		return fmt.Errorf("sig: Alg %d has no name", uint16(a.Alg))
+	case a.Verify == nil:
+		return fmt.Errorf("sig: %v has no Verify func", a.Name)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if r, ok := registry.algs[a.Alg]; ok {
+		return fmt.Errorf("sig: Alg %d is already registered as %v", uint16(a.Alg), r.Name)
+	}
+	if _, ok := registry.names[a.Name]; ok {
+		return fmt.Errorf("sig: %v is already registered", a.Name)
+	}
+	if a.Key != nil {
+		gob.Register(a.Key)
+	}
+	registry.algs[a.Alg] = a
+	registry.names[a.Name] = a.Alg
+	return nil
+}
+
+// MustRegister is like Register but panics on error. It is intended for init funcs.
+func MustRegister(a Algorithm) {
+	if err := Register(a); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the registered Algorithm for an Alg. The error for an unregistered
+// Alg wraps ErrUnknownAlg and lists the registered algorithms.
+func Lookup(alg Alg) (Algorithm, error) {
+	registry.RLock()
+	a, ok := registry.algs[alg]
+	registry.RUnlock()
+	if !ok {
+		return Algorithm{}, fmt.Errorf("%w: %d, registered algorithms are %v", ErrUnknownAlg, uint16(alg), registeredNames())
+	}
+	return a, nil
+}
+
+// LookupName returns the registered Algorithm for a name, such as xmss_sha2_10_256.
+func LookupName(name string) (Algorithm, error) {
+	registry.RLock()
+	alg, ok := registry.names[name]
+	registry.RUnlock()
+	if !ok {
+		return Algorithm{}, fmt.Errorf("%w: %q, registered algorithms are %v", ErrUnknownAlg, name, registeredNames())
+	}
+	return Lookup(alg)
+}
+
+// Algorithms returns all registered Algorithms ordered by Alg.
+func Algorithms() []Algorithm {
+	registry.RLock()
+	o := make([]Algorithm, 0, len(registry.algs))
+	for _, a := range registry.algs {
+		o = append(o, a)
+	}
+	registry.RUnlock()
+	sort.Slice(o, func(i, j int) bool { return o[i].Alg < o[j].Alg })
+	return o
+}
+
+// registeredNames returns a comma separated list of the registered algorithm names
+func registeredNames() string {
+	var names []string
+	for _, a := range Algorithms() {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// MarshalKey returns the private key bytes of a Signer using the registered Algorithm
+// for its Alg. The Signer must implement Keyer.
+func MarshalKey(s Signer) ([]byte, error) {
+	k, ok := s.(Keyer)
+	if !ok {
+		return nil, fmt.Errorf("sig: %T does not implement Keyer", s)
+	}
+	a, err := Lookup(k.Alg())
+	if err != nil {
+		return nil, err
+	}
+	if a.MarshalKey == nil {
+		return nil, fmt.Errorf("sig: %v has no key codec", a.Name)
+	}
+	return a.MarshalKey(s)
+}
+
+// UnmarshalKey returns a Signer for an Alg from private key bytes returned by MarshalKey.
+func UnmarshalKey(alg Alg, b []byte) (Signer, error) {
+	a, err := Lookup(alg)
+	if err != nil {
+		return nil, err
+	}
+	if a.UnmarshalKey == nil {
+		return nil, fmt.Errorf("sig: %v has no key codec", a.Name)
+	}
+	return a.UnmarshalKey(b)
+}
+
+// keyCodec returns MarshalKey and UnmarshalKey funcs for a Signer type T whose private
+// key is a fixed size byte slice. get returns the private key of a T and set returns
+// a new T from private key bytes of the correct size.
+func keyCodec[T Signer](name string, size int, get func(T) []byte, set func([]byte) T) (func(Signer) ([]byte, error), func([]byte) (Signer, error)) {
+	marshal := func(s Signer) ([]byte, error) {
+		t, ok := s.(T)
+		if !ok {
+			return nil, fmt.Errorf("sig: %T is not a %v signer", s, name)
+		}
+		return get(t), nil
+	}
+	unmarshal := func(b []byte) (Signer, error) {
+		if len(b) != size {
+			return nil, fmt.Errorf("sig: %v private key is %d bytes, expected %d", name, len(b), size)
+		}
+		return set(b), nil
+	}
+	return marshal, unmarshal
+}
+
+// VerifyBundle verifies a Bundle against a message using the registered Algorithm for
+// the Bundle's Alg. It returns an error wrapping ErrUnknownAlg for unregistered algorithms,
+// or ErrInvalidSignature for wrongly sized keys and signatures and failed verification.
+func VerifyBundle(message []byte, b Bundle) error {
+	a, err := Lookup(b.Alg)
+	if err != nil {
+		return err
+	}
+	if a.PubKeySize != 0 && len(b.Pub) != a.PubKeySize {
+		return fmt.Errorf("%w: %v public key is %d bytes, expected %d", ErrInvalidSignature, a.Name, len(b.Pub), a.PubKeySize)
+	}
+	if a.SigSize != 0 && len(b.Sig) != a.SigSize {
+		return fmt.Errorf("%w: %v signature is %d bytes, expected %d", ErrInvalidSignature, a.Name, len(b.Sig), a.SigSize)
+	}
+	if !a.Verify(message, b) {
+		return fmt.Errorf("%w: %v signature does not verify", ErrInvalidSignature, a.Name)
+	}
+	return nil
+}
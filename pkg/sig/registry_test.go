@@ -0,0 +1,124 @@
+package sig
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	verify := func(message []byte, b Bundle) bool {
+		return bytes.Equal(b.Sig, message)
+	}
+	test := Algorithm{Alg: 0xfff0, Name: "test_register", Verify: verify}
+	if err := Register(test); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		alg  Algorithm
+	}{
+		{"reserved alg", Algorithm{Name: "reserved", Verify: verify}},
+		{"missing name", Algorithm{Alg: 0xfff1, Verify: verify}},
+		{"missing verify", Algorithm{Alg: 0xfff1, Name: "no_verify"}},
+		{"duplicate alg", Algorithm{Alg: 0xfff0, Name: "duplicate", Verify: verify}},
+		{"duplicate name", Algorithm{Alg: 0xfff1, Name: "nacl_sign", Verify: verify}},
+	}
+	for _, test := range tests {
+		if err := Register(test.alg); err == nil {
+			t.Errorf("%v: expected error", test.name)
+		}
+	}
+
+	a, err := LookupName("test_register")
+	if err != nil || a.Alg != 0xfff0 {
+		t.Errorf("lookup name: %+v, %v", a, err)
+	}
+	if Alg(0xfff0).String() != "test_register" || Alg(0xfff0).PQR() {
+		t.Errorf("unexpected alg: %v", Alg(0xfff0))
+	}
+	if err := VerifyBundle([]byte("m"), Bundle{Alg: 0xfff0, Sig: []byte("m")}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	a, err := Lookup(AlgNaClSign)
+	if err != nil || a.Name != "nacl_sign" {
+		t.Errorf("lookup: %+v, %v", a, err)
+	}
+	_, err = Lookup(0xffff)
+	if !errors.Is(err, ErrUnknownAlg) || !strings.Contains(err.Error(), "nacl_sign") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := LookupName("unknown"); !errors.Is(err, ErrUnknownAlg) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	algs := Algorithms()
+	for i := 1; i < len(algs); i++ {
+		if algs[i-1].Alg >= algs[i].Alg {
+			t.Errorf("algorithms out of order: %v, %v", algs[i-1].Alg, algs[i].Alg)
+		}
+	}
+}
+
+func TestVerifyBundle(t *testing.T) {
+	t.Parallel()
+
+	m := []byte("sign me, plz.")
+	b, err := GenNaclSign().Sign(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBundle(m, b); err != nil {
+		t.Error(err)
+	}
+
+	tests := []struct {
+		name   string
+		bundle Bundle
+		err    error
+	}{
+		{"unknown alg", Bundle{Alg: 0xffff, Pub: b.Pub, Sig: b.Sig}, ErrUnknownAlg},
+		{"short pub", Bundle{Alg: b.Alg, Pub: b.Pub[:31], Sig: b.Sig}, ErrInvalidSignature},
+		{"short sig", Bundle{Alg: b.Alg, Pub: b.Pub, Sig: b.Sig[:63]}, ErrInvalidSignature},
+		{"bad sig", Bundle{Alg: b.Alg, Pub: b.Pub, Sig: make([]byte, 64)}, ErrInvalidSignature},
+	}
+	for _, test := range tests {
+		if err := VerifyBundle(m, test.bundle); !errors.Is(err, test.err) {
+			t.Errorf("%v: expected %v, got: %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestKeyCodec(t *testing.T) {
+	t.Parallel()
+
+	signers := []Signer{GenNaclSign(), GenECDSAP256(), GenSecp256k1(), GenMLDSA65(), GenXMSS10()}
+	for _, s := range signers {
+		k := s.(Keyer)
+		b, err := MarshalKey(s)
+		if err != nil {
+			t.Fatalf("%v: %v", k.Alg(), err)
+		}
+		u, err := UnmarshalKey(k.Alg(), b)
+		if err != nil {
+			t.Fatalf("%v: %v", k.Alg(), err)
+		}
+		if !bytes.Equal(u.(Keyer).PublicKey(), k.PublicKey()) {
+			t.Errorf("%v: public key mismatch after round trip", k.Alg())
+		}
+		if _, err := UnmarshalKey(k.Alg(), b[1:]); err == nil {
+			t.Errorf("%v: failed to catch short private key", k.Alg())
+		}
+	}
+	if _, err := UnmarshalKey(0xffff, nil); !errors.Is(err, ErrUnknownAlg) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
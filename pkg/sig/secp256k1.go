@@ -0,0 +1,105 @@
+package sig
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// secp256k1PubKeySize is the size of a SEC 1 compressed secp256k1 point
+const secp256k1PubKeySize = 33
+
+func init() {
+	marshal, unmarshal := keyCodec("secp256k1_sha256", 32,
+		func(s *Secp256k1) []byte { return append([]byte{}, s.prv[:]...) },
+		func(b []byte) *Secp256k1 { return NewSecp256k1(b) },
+	)
+	MustRegister(Algorithm{
+		Alg:          AlgSecp256k1,
+		Name:         "secp256k1_sha256",
+		PubKeySize:   secp256k1PubKeySize,
+		SigSize:      ecdsaSigSize,
+		Verify:       VerifySecp256k1,
+		Key:          &Secp256k1{},
+		Gen:          func() Signer { return GenSecp256k1() },
+		MarshalKey:   marshal,
+		UnmarshalKey: unmarshal,
+	})
+}
+
+// Secp256k1 holds a 32 byte secp256k1 private scalar. It implements the Signer interface
+// with deterministic RFC 6979, low-S, signatures of the SHA-256 digest of a message.
+type Secp256k1 struct {
+	prv [32]byte
+}
+
+// GenSecp256k1 returns a randomly generated secp256k1 private key in a Secp256k1
+func GenSecp256k1() *Secp256k1 {
+	k, _ := secp256k1.GeneratePrivateKey()
+	return &Secp256k1{prv: k.Key.Bytes()}
+}
+
+// NewSecp256k1 takes a 32 byte big endian secp256k1 private scalar, such as one exported
+// from a wallet, and returns a Secp256k1
+func NewSecp256k1(privateKey []byte) *Secp256k1 {
+	var pk [32]byte
+	copy(pk[:], privateKey)
+	return &Secp256k1{prv: pk}
+}
+
+// Alg returns AlgSecp256k1
+func (s *Secp256k1) Alg() Alg {
+	return AlgSecp256k1
+}
+
+// PublicKey returns the 33 byte SEC 1 compressed public key
+func (s *Secp256k1) PublicKey() []byte {
+	return secp256k1.PrivKeyFromBytes(s.prv[:]).PubKey().SerializeCompressed()
+}
+
+// Sign takes a message and returns a Bundle with a deterministic 64 byte r|s signature
+// of the SHA-256 digest of the message.
+func (s *Secp256k1) Sign(message []byte) (Bundle, error) {
+	k := secp256k1.PrivKeyFromBytes(s.prv[:])
+	if k.Key.IsZero() {
+		return Bundle{}, errors.New("invalid secp256k1 private key")
+	}
+	digest := sha256.Sum256(message)
+	signature := ecdsa.Sign(k, digest[:])
+	r, sv := signature.R(), signature.S()
+	sig := make([]byte, ecdsaSigSize)
+	r.PutBytesUnchecked(sig[:32])
+	sv.PutBytesUnchecked(sig[32:])
+
+	b := Bundle{
+		Alg: AlgSecp256k1,
+		Pub: k.PubKey().SerializeCompressed(),
+		Sig: sig,
+	}
+
+	if ok := VerifySecp256k1(message, b); !ok {
+		return Bundle{}, errors.New("verification sanity check failed on sign")
+	}
+
+	return b, nil
+}
+
+// VerifySecp256k1 takes a message and a Bundle and returns a bool indicating if the
+// message is verified by the r|s signature and compressed public key.
+func VerifySecp256k1(msg []byte, b Bundle) bool {
+	if len(b.Sig) != ecdsaSigSize || len(b.Pub) != secp256k1PubKeySize {
+		return false
+	}
+	pub, err := secp256k1.ParsePubKey(b.Pub)
+	if err != nil {
+		return false
+	}
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(b.Sig[:32]) || s.SetByteSlice(b.Sig[32:]) {
+		return false
+	}
+	digest := sha256.Sum256(msg)
+	return ecdsa.NewSignature(&r, &s).Verify(digest[:], pub)
+}
@@ -0,0 +1,61 @@
+package sig
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestSecp256k1(t *testing.T) {
+	t.Parallel()
+
+	m := []byte("sign me, plz.")
+
+	t.Run("deterministic", func(t *testing.T) {
+		t.Parallel()
+		s := GenSecp256k1()
+		b1, err := s.Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b2, err := s.Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b1.Sig, b2.Sig) {
+			t.Error("signatures are not deterministic")
+		}
+		if len(b1.Pub) != secp256k1PubKeySize || !bytes.Equal(b1.Pub, s.PublicKey()) {
+			t.Errorf("unexpected public key: %x", b1.Pub)
+		}
+		halfOrder := new(big.Int).Rsh(secp256k1.S256().N, 1)
+		if new(big.Int).SetBytes(b1.Sig[32:]).Cmp(halfOrder) > 0 {
+			t.Error("signature is not low-S")
+		}
+		if !Verify(m, b1) {
+			t.Error("verification failed")
+		}
+		if Verify([]byte("other"), b1) {
+			t.Error("verified the wrong message")
+		}
+	})
+	t.Run("overflowed signature", func(t *testing.T) {
+		t.Parallel()
+		b, err := GenSecp256k1().Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(b.Sig[:32], bytes.Repeat([]byte{0xff}, 32))
+		if Verify(m, b) {
+			t.Error("overflowed r not caught")
+		}
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		t.Parallel()
+		if _, err := NewSecp256k1(make([]byte, 32)).Sign(m); err == nil {
+			t.Error("invalid key not caught")
+		}
+	})
+}
@@ -1,5 +1,10 @@
 package sig
 
+import (
+	"context"
+	"fmt"
+)
+
 // Alg type is used for setting the Algorithm in a Signature Set
 type Alg uint16
 
@@ -13,8 +18,33 @@ const (
 	AlgNaClSign
 	// AlgXMSS10 is meant for xmss sha2_10_256
 	AlgXMSS10
+	// AlgECDSAP256 is meant for deterministic ECDSA P-256 with SHA-256
+	AlgECDSAP256
+	// AlgSecp256k1 is meant for deterministic ECDSA secp256k1 with SHA-256
+	AlgSecp256k1
+	// AlgXMSS16 is meant for xmss sha2_16_256
+	AlgXMSS16
+	// reserved for xmss sha2_20_256, which is not registered until there is a signer
+	// that caches tree state instead of recomputing the tree for every signature
+	_
+	// AlgMLDSA65 is meant for the stateless ML-DSA-65 (FIPS 204) scheme
+	AlgMLDSA65
 )
 
+// String returns the registered name of an Alg, such as nacl_sign or xmss_sha2_10_256.
+func (a Alg) String() string {
+	if r, err := Lookup(a); err == nil {
+		return r.Name
+	}
+	return fmt.Sprintf("unknown_alg_%d", uint16(a))
+}
+
+// PQR returns true if an Alg is registered as post-quantum resistant.
+func (a Alg) PQR() bool {
+	r, err := Lookup(a)
+	return err == nil && r.PQR
+}
+
 // Bundle is used to encapsulate an Algorithm implementation, A Public Key, and a Signature.
 // A Bundle is designed to be used to verify the integrity of the Payload.
 type Bundle struct {
@@ -28,15 +58,55 @@ type Signer interface {
 	Sign(message []byte) (Bundle, error)
 }
 
+// ContextSigner is an optional interface for a Signer that can be canceled, such as
+// a Signer backed by a signing agent, HSM or remote service.
+type ContextSigner interface {
+	Signer
+	SignContext(ctx context.Context, message []byte) (Bundle, error)
+}
+
+// SignContext signs a message with s, using SignContext if s is a ContextSigner.
+// Other signers can not be interrupted, so ctx is only checked before Sign is called.
+func SignContext(ctx context.Context, s Signer, message []byte) (Bundle, error) {
+	if c, ok := s.(ContextSigner); ok {
+		return c.SignContext(ctx, message)
+	}
+	if err := ctx.Err(); err != nil {
+		return Bundle{}, err
+	}
+	return s.Sign(message)
+}
+
+// Keyer is an optional interface for a Signer that can describe its key
+// without signing a message.
+type Keyer interface {
+	Alg() Alg
+	PublicKey() []byte
+}
+
+// Stateful is an optional interface for a Signer with a limited number of one-time
+// keys, such as XMSS. Remaining returns the number of signatures left, and Capacity
+// the total number of signatures the key can produce.
+type Stateful interface {
+	Remaining() uint64
+	Capacity() uint64
+}
+
+// ExhaustedError is returned by a Stateful Signer that has used all of its one-time keys.
+type ExhaustedError struct {
+	Alg      Alg
+	Capacity uint64
+}
+
+// Error implements the error interface for ExhaustedError
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("sig: %v key exhausted, all %d signatures used", e.Alg, e.Capacity)
+}
+
 // Verify takes a message and a signature Bundle and attempts to verify
-// the bundle based on bundle's implemented Alg, the sig, and the pubkey.
-// Verify returns a simple true or false.
+// the bundle based on bundle's registered Alg, the sig, and the pubkey.
+// Verify returns a simple true or false, use VerifyBundle for the reason
+// a Bundle fails to verify.
 func Verify(message []byte, bundle Bundle) bool {
-	switch bundle.Alg {
-	case AlgNaClSign:
-		return VerifyNaclSign(message, bundle)
-	case AlgXMSS10:
-		return VerifyXMSS10(message, bundle)
-	}
-	return false
+	return VerifyBundle(message, bundle) == nil
 }
@@ -35,3 +35,28 @@ func TestVerify(t *testing.T) {
 		}
 	})
 }
+
+func TestAlg(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		alg  Alg
+		name string
+		pqr  bool
+	}{
+		{alg: AlgNaClSign, name: "nacl_sign"},
+		{alg: AlgXMSS10, name: "xmss_sha2_10_256", pqr: true},
+		{alg: AlgECDSAP256, name: "ecdsa_p256_sha256"},
+		{alg: AlgSecp256k1, name: "secp256k1_sha256"},
+		{alg: AlgMLDSA65, name: "ml_dsa_65", pqr: true},
+		{alg: 0, name: "unknown_alg_0"},
+	}
+	for _, test := range tests {
+		if test.alg.String() != test.name {
+			t.Errorf("actual: %v, expected: %v", test.alg.String(), test.name)
+		}
+		if test.alg.PQR() != test.pqr {
+			t.Errorf("pqr mismatch for %v", test.alg)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package sigutil
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Names of the key derivation function and cipher used by encrypted keysets
+const (
+	KDFArgon2id             = "argon2id"
+	CipherXChaCha20Poly1305 = "xchacha20poly1305"
+)
+
+// argon2id parameters for new encrypted keysets, following the RFC 9106 second
+// recommended option with 64 MiB of memory
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonSaltLen = 16
+
+	// argonMaxMemory and argonMaxTime bound the parameters read from a keyset
+	// file so that a crafted file can not exhaust memory or stall decryption.
+	argonMaxMemory = 1024 * 1024
+	argonMaxTime   = 64
+)
+
+var (
+	// ErrPassphraseRequired is returned when decoding an encrypted keyset without a passphrase
+	ErrPassphraseRequired = errors.New("sigutil: keyset is encrypted, a passphrase is required")
+	// ErrDecryptKeySet is returned when an encrypted keyset can not be decrypted, either
+	// because the passphrase is wrong or the file has been modified.
+	ErrDecryptKeySet = errors.New("sigutil: incorrect passphrase or corrupt keyset")
+)
+
+// Option is used for interacting with the keyset decoding options
+type Option func(*options)
+
+type options struct {
+	passphrase func() ([]byte, error)
+}
+
+// parseOptions takes a set of Option and returns options
+func parseOptions(opts ...Option) options {
+	var o options
+	for _, option := range opts {
+		option(&o)
+	}
+	return o
+}
+
+// WithPassphrase sets the func that returns the passphrase for an encrypted keyset.
+// It is only called when the keyset being decoded is encrypted, so that callers can
+// prompt for a passphrase lazily.
+func WithPassphrase(f func() ([]byte, error)) Option {
+	return func(o *options) {
+		o.passphrase = f
+	}
+}
+
+// readPassphrase calls the passphrase func, returning ErrPassphraseRequired if it is unset
+func (o options) readPassphrase() ([]byte, error) {
+	if o.passphrase == nil {
+		return nil, ErrPassphraseRequired
+	}
+	return o.passphrase()
+}
+
+// keySetAD is the additional data authenticated with every encrypted keyset
+var keySetAD = []byte("hashmap keyset")
+
+// EncryptedKeySet is the file format of a passphrase encrypted keyset. Ciphertext
+// is the XChaCha20-Poly1305 encryption of a JSON KeySet, with a key derived from
+// the passphrase with argon2id.
+type EncryptedKeySet struct {
+	Version    int       `json:"version"`
+	KDF        KDFParams `json:"kdf"`
+	Cipher     string    `json:"cipher"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// KDFParams are the argon2id parameters used to derive an encrypted keyset key.
+// Memory is in KiB.
+type KDFParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// keySetCipher holds the derived key of an encrypted keyset so that it can be
+// re-encrypted on every save without running the KDF again.
+type keySetCipher struct {
+	kdf KDFParams
+	key []byte
+}
+
+// newKeySetCipher derives a key from a passphrase with a new random salt
+func newKeySetCipher(passphrase []byte) (*keySetCipher, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("sigutil: passphrase is empty")
+	}
+	kdf := KDFParams{
+		Name:    KDFArgon2id,
+		Salt:    make([]byte, argonSaltLen),
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+	}
+	if _, err := rand.Read(kdf.Salt); err != nil {
+		return nil, err
+	}
+	return &keySetCipher{kdf: kdf, key: kdf.derive(passphrase)}, nil
+}
+
+// derive returns the 32 byte key for a passphrase
+func (p KDFParams) derive(passphrase []byte) []byte {
+	return argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, chacha20poly1305.KeySize)
+}
+
+// validate checks that the parameters are supported and within safe bounds
+func (p KDFParams) validate() error {
+	switch {
+	case p.Name != KDFArgon2id:
+		return fmt.Errorf("sigutil: unsupported keyset kdf: %q", p.Name)
+	case len(p.Salt) < argonSaltLen:
+		return errors.New("sigutil: keyset kdf salt is too short")
+	case p.Time == 0 || p.Time > argonMaxTime:
+		return fmt.Errorf("sigutil: keyset kdf time %d is out of range", p.Time)
+	case p.Memory == 0 || p.Memory > argonMaxMemory:
+		return fmt.Errorf("sigutil: keyset kdf memory %d KiB is out of range", p.Memory)
+	case p.Threads == 0:
+		return errors.New("sigutil: keyset kdf threads must be at least 1")
+	}
+	return nil
+}
+
+// seal encrypts a KeySet with a new random nonce and returns the indented JSON
+// encoding of the EncryptedKeySet
+func (c *keySetCipher) seal(ks *KeySet) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(ks)
+	if err != nil {
+		return nil, err
+	}
+	e := EncryptedKeySet{
+		Version: KeySetVersion,
+		KDF:     c.kdf,
+		Cipher:  CipherXChaCha20Poly1305,
+		Nonce:   make([]byte, aead.NonceSize()),
+	}
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext, keySetAD)
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// openKeySet decrypts an encrypted keyset and returns the KeySet and the cipher
+// to re-encrypt it with
+func openKeySet(b []byte, passphrase []byte) (*KeySet, *keySetCipher, error) {
+	var e EncryptedKeySet
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, nil, err
+	}
+	if e.Version != KeySetVersion {
+		return nil, nil, fmt.Errorf("%w: %d", ErrKeySetVersion, e.Version)
+	}
+	if e.Cipher != CipherXChaCha20Poly1305 {
+		return nil, nil, fmt.Errorf("sigutil: unsupported keyset cipher: %q", e.Cipher)
+	}
+	if err := e.KDF.validate(); err != nil {
+		return nil, nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, nil, ErrPassphraseRequired
+	}
+	c := &keySetCipher{kdf: e.KDF, key: e.KDF.derive(passphrase)}
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, nil, ErrDecryptKeySet
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, keySetAD)
+	if err != nil {
+		return nil, nil, ErrDecryptKeySet
+	}
+	ks, err := unmarshalJSONKeySet(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ks, c, nil
+}
+
+// EncryptKeySet encrypts a KeySet with a key derived from passphrase and returns
+// the JSON encoded EncryptedKeySet
+func EncryptKeySet(ks *KeySet, passphrase []byte) ([]byte, error) {
+	c, err := newKeySetCipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return c.seal(ks)
+}
+
+// DecryptKeySet decrypts a JSON encoded EncryptedKeySet with passphrase. It returns
+// ErrDecryptKeySet if the passphrase is wrong or the keyset has been modified.
+func DecryptKeySet(b []byte, passphrase []byte) (*KeySet, error) {
+	ks, _, err := openKeySet(b, passphrase)
+	return ks, err
+}
+
+// IsEncryptedKeySet returns true if b is a JSON encoded EncryptedKeySet
+func IsEncryptedKeySet(b []byte) bool {
+	if IsLegacyKeySet(b) {
+		return false
+	}
+	var e struct {
+		Ciphertext json.RawMessage `json:"ciphertext"`
+	}
+	return json.Unmarshal(b, &e) == nil && len(e.Ciphertext) > 0
+}
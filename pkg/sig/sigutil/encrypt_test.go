@@ -0,0 +1,158 @@
+package sigutil
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestEncryptKeySet(t *testing.T) {
+	t.Parallel()
+
+	passphrase := []byte("correct horse battery staple")
+	ks, err := NewKeySet(NewDefaultSigners(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncryptKeySet(ks, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedKeySet(b) {
+		t.Fatal("encrypted keyset not detected")
+	}
+	plain, err := MarshalKeySet(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsEncryptedKeySet(plain) {
+		t.Error("plaintext keyset detected as encrypted")
+	}
+
+	t.Run("decrypt", func(t *testing.T) {
+		t.Parallel()
+		signers, err := Decode(b, WithPassphrase(func() ([]byte, error) { return passphrase, nil }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(signers) != 1 || signers[0].(sig.Keyer).Alg() != sig.AlgNaClSign {
+			t.Errorf("unexpected signers: %v", signers)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		if _, err := Decode(b); !errors.Is(err, ErrPassphraseRequired) {
+			t.Errorf("unexpected error without passphrase: %v", err)
+		}
+		if _, err := DecryptKeySet(b, []byte("wrong")); !errors.Is(err, ErrDecryptKeySet) {
+			t.Errorf("unexpected error with wrong passphrase: %v", err)
+		}
+		if _, err := EncryptKeySet(ks, nil); err == nil {
+			t.Error("failed to catch empty passphrase")
+		}
+	})
+	t.Run("kdf params", func(t *testing.T) {
+		t.Parallel()
+		tests := []struct {
+			name   string
+			modify func(*EncryptedKeySet)
+		}{
+			{"kdf name", func(e *EncryptedKeySet) { e.KDF.Name = "scrypt" }},
+			{"memory", func(e *EncryptedKeySet) { e.KDF.Memory = argonMaxMemory + 1 }},
+			{"time", func(e *EncryptedKeySet) { e.KDF.Time = 0 }},
+			{"salt", func(e *EncryptedKeySet) { e.KDF.Salt = e.KDF.Salt[:8] }},
+			{"cipher", func(e *EncryptedKeySet) { e.Cipher = "aes" }},
+		}
+		for _, test := range tests {
+			var e EncryptedKeySet
+			if err := json.Unmarshal(b, &e); err != nil {
+				t.Fatal(err)
+			}
+			test.modify(&e)
+			m, err := json.Marshal(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DecryptKeySet(m, passphrase); err == nil {
+				t.Errorf("%v: failed to catch invalid parameters", test.name)
+			}
+		}
+	})
+}
+
+func TestKeySetFileEncrypted(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "hashmap-keyset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hashmap.keyset")
+	passphrase := []byte("hunter2")
+	opt := WithPassphrase(func() ([]byte, error) { return passphrase, nil })
+	ks, err := NewKeySet(NewExperimentalSigners(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncryptKeySet(ks, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenKeySetFile(path); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("unexpected error without passphrase: %v", err)
+	}
+	k, err := OpenKeySetFile(path, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.Encrypted() {
+		t.Error("keyset not reported as encrypted")
+	}
+	if _, err := SignAll([]byte("hello, world"), k.Signers()); err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedKeySet(b) {
+		t.Fatal("keyset was saved unencrypted after signing")
+	}
+	ks, err = DecryptKeySet(b, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Keys[1].State.Used != 1 {
+		t.Errorf("xmss state was not persisted: %+v", ks.Keys[1].State)
+	}
+
+	k, err = OpenKeySetFile(path, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	if err := k.SetPassphrase(nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsEncryptedKeySet(b) || k.Encrypted() {
+		t.Error("keyset is still encrypted")
+	}
+}
@@ -0,0 +1,159 @@
+package sigutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+// KeySetVersion is the current version of the keyset file format
+const KeySetVersion = 1
+
+// ErrKeySetVersion is returned when decoding a keyset with an unsupported version
+var ErrKeySetVersion = errors.New("sigutil: unsupported keyset version")
+
+// KeySet is the versioned JSON keyset file format. Keys are kept in signing order,
+// which is also the order their public keys are hashed in to derive the endpoint.
+type KeySet struct {
+	Version int   `json:"version"`
+	Keys    []Key `json:"keys"`
+}
+
+// Key is a single key in a KeySet. Alg is the registered sig algorithm name, and
+// PrivateKey the bytes of the registered key codec, which for stateful algorithms
+// includes the signature index. Created is zero for keys migrated from gob keysets.
+type Key struct {
+	Alg        string    `json:"alg"`
+	Created    time.Time `json:"created,omitzero"`
+	PublicKey  []byte    `json:"public_key"`
+	PrivateKey []byte    `json:"private_key"`
+	State      *KeyState `json:"state,omitempty"`
+}
+
+// KeyState records how many of the one-time signatures of a stateful key, such
+// as XMSS, have been used. It is informational, the private key is authoritative.
+type KeyState struct {
+	Used     uint64 `json:"used"`
+	Capacity uint64 `json:"capacity"`
+}
+
+// NewKeySet returns a KeySet for a slice of sig.Signer with every key created at created
+func NewKeySet(signers []sig.Signer, created time.Time) (*KeySet, error) {
+	ks := &KeySet{Version: KeySetVersion, Keys: make([]Key, len(signers))}
+	for i, s := range signers {
+		ks.Keys[i].Created = created.UTC()
+		if err := ks.Keys[i].update(s); err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+	}
+	return ks, nil
+}
+
+// update sets the algorithm, keys and state of a Key from a sig.Signer
+func (k *Key) update(s sig.Signer) error {
+	keyer, ok := s.(sig.Keyer)
+	if !ok {
+		return fmt.Errorf("sigutil: %T does not implement sig.Keyer", s)
+	}
+	priv, err := sig.MarshalKey(s)
+	if err != nil {
+		return fmt.Errorf("sigutil: %T: %w", s, err)
+	}
+	k.Alg = keyer.Alg().String()
+	k.PublicKey = keyer.PublicKey()
+	k.PrivateKey = priv
+	k.State = nil
+	if st, ok := s.(sig.Stateful); ok {
+		k.State = &KeyState{Used: st.Capacity() - st.Remaining(), Capacity: st.Capacity()}
+	}
+	return nil
+}
+
+// Signers returns the keys of a KeySet as a slice of sig.Signer. It returns an error
+// if a public key or state does not match its private key.
+func (ks *KeySet) Signers() ([]sig.Signer, error) {
+	signers := make([]sig.Signer, len(ks.Keys))
+	for i, k := range ks.Keys {
+		a, err := sig.LookupName(k.Alg)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		s, err := sig.UnmarshalKey(a.Alg, k.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		var check Key
+		if err := check.update(s); err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		if !bytes.Equal(check.PublicKey, k.PublicKey) {
+			return nil, fmt.Errorf("key %d: sigutil: %v public key does not match private key", i, k.Alg)
+		}
+		if k.State != nil && (check.State == nil || *check.State != *k.State) {
+			return nil, fmt.Errorf("key %d: sigutil: %v state does not match private key", i, k.Alg)
+		}
+		signers[i] = s
+	}
+	return signers, nil
+}
+
+// MarshalKeySet returns the indented JSON encoding of a KeySet
+func MarshalKeySet(ks *KeySet) ([]byte, error) {
+	b, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// UnmarshalKeySet decodes a JSON KeySet. Encrypted keysets are decrypted with the
+// passphrase set by WithPassphrase. Keysets written as gob by earlier versions are
+// migrated to a KeySet with zero creation times, and are written in the JSON format
+// the next time they are saved.
+func UnmarshalKeySet(b []byte, opts ...Option) (*KeySet, error) {
+	ks, _, err := unmarshalKeySet(b, parseOptions(opts...))
+	return ks, err
+}
+
+// unmarshalKeySet decodes a keyset in any supported format and returns the KeySet and,
+// for encrypted keysets, the cipher to re-encrypt it with
+func unmarshalKeySet(b []byte, o options) (*KeySet, *keySetCipher, error) {
+	if IsLegacyKeySet(b) {
+		signers, err := decodeGob(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		ks, err := NewKeySet(signers, time.Time{})
+		return ks, nil, err
+	}
+	if IsEncryptedKeySet(b) {
+		passphrase, err := o.readPassphrase()
+		if err != nil {
+			return nil, nil, err
+		}
+		return openKeySet(b, passphrase)
+	}
+	ks, err := unmarshalJSONKeySet(b)
+	return ks, nil, err
+}
+
+// unmarshalJSONKeySet decodes an unencrypted JSON KeySet and checks its version
+func unmarshalJSONKeySet(b []byte) (*KeySet, error) {
+	var ks KeySet
+	if err := json.Unmarshal(b, &ks); err != nil {
+		return nil, err
+	}
+	if ks.Version != KeySetVersion {
+		return nil, fmt.Errorf("%w: %d", ErrKeySetVersion, ks.Version)
+	}
+	return &ks, nil
+}
+
+// IsLegacyKeySet returns true if b is not a JSON object and so is treated as a gob keyset
+func IsLegacyKeySet(b []byte) bool {
+	return !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{"))
+}
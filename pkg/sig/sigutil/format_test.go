@@ -0,0 +1,124 @@
+package sigutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestKeySetFormat(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	x := sig.GenXMSS10()
+	if _, err := x.Sign([]byte("hello, world")); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := NewKeySet([]sig.Signer{sig.GenNaclSign(), x}, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := MarshalKeySet(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+		if IsLegacyKeySet(b) {
+			t.Error("json keyset reported as legacy")
+		}
+		u, err := UnmarshalKeySet(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Version != KeySetVersion || len(u.Keys) != 2 {
+			t.Fatalf("unexpected keyset: %+v", u)
+		}
+		k := u.Keys[1]
+		if k.Alg != "xmss_sha2_10_256" || !k.Created.Equal(created) || k.State == nil || *k.State != (KeyState{Used: 1, Capacity: 1024}) {
+			t.Errorf("unexpected key: %+v", k)
+		}
+		signers, err := u.Signers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signers[1].(*sig.XMSS10).PrivateKey != x.PrivateKey {
+			t.Error("xmss private key mismatch")
+		}
+	})
+	t.Run("mismatch", func(t *testing.T) {
+		t.Parallel()
+		tests := []struct {
+			name   string
+			modify func(*KeySet)
+		}{
+			{"public key", func(ks *KeySet) { ks.Keys[0].PublicKey = make([]byte, 32) }},
+			{"state", func(ks *KeySet) { ks.Keys[1].State.Used = 0 }},
+			{"alg", func(ks *KeySet) { ks.Keys[0].Alg = "unknown" }},
+			{"private key size", func(ks *KeySet) { ks.Keys[0].PrivateKey = ks.Keys[0].PrivateKey[1:] }},
+		}
+		for _, test := range tests {
+			u, err := UnmarshalKeySet(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.modify(u)
+			if _, err := u.Signers(); err == nil {
+				t.Errorf("%v: failed to catch mismatch", test.name)
+			}
+		}
+	})
+	t.Run("version", func(t *testing.T) {
+		t.Parallel()
+		v, err := json.Marshal(KeySet{Version: KeySetVersion + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := UnmarshalKeySet(v); !errors.Is(err, ErrKeySetVersion) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestKeySetMigration(t *testing.T) {
+	t.Parallel()
+
+	b, err := ioutil.ReadFile("../../../test/testdata/hashmap_ed25519.keyset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsLegacyKeySet(b) {
+		t.Fatal("gob keyset not reported as legacy")
+	}
+	legacy, err := decodeGob(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := UnmarshalKeySet(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Keys) != 1 || ks.Keys[0].Alg != "nacl_sign" || !ks.Keys[0].Created.IsZero() {
+		t.Fatalf("unexpected migrated keyset: %+v", ks)
+	}
+	m, err := MarshalKeySet(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers, err := Decode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signers[0].(sig.Keyer).PublicKey(), legacy[0].(sig.Keyer).PublicKey()) {
+		t.Error("migrated public key does not match legacy keyset")
+	}
+	if bytes.Contains(m, []byte(`"created"`)) {
+		t.Error("migrated key should omit created")
+	}
+}
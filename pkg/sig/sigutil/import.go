@@ -0,0 +1,139 @@
+package sigutil
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyFormat is a standard encoding of an ed25519 private key used to import keys into,
+// and export keys from, a keyset. Other algorithms have no widely used key formats.
+type KeyFormat int
+
+const (
+	// KeyFormatOpenSSH is the PEM armored "OPENSSH PRIVATE KEY" format of ssh-keygen
+	KeyFormatOpenSSH KeyFormat = iota + 1
+	// KeyFormatPKCS8 is a PEM armored "PRIVATE KEY" in PKCS #8, as written by openssl
+	KeyFormatPKCS8
+	// KeyFormatSeed is the raw 32 byte RFC 8032 seed. Seeds are also parsed from hex
+	// or base64 text.
+	KeyFormatSeed
+)
+
+// ErrUnsupportedKey is returned when a private key is not an ed25519 key in a supported format
+var ErrUnsupportedKey = errors.New("sigutil: unsupported private key, expected an ed25519 key in openssh, pkcs8 or seed format")
+
+var keyFormatNames = map[KeyFormat]string{
+	KeyFormatOpenSSH: "openssh",
+	KeyFormatPKCS8:   "pkcs8",
+	KeyFormatSeed:    "seed",
+}
+
+// String returns the name of a KeyFormat
+func (f KeyFormat) String() string {
+	if n, ok := keyFormatNames[f]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown_key_format_%d", int(f))
+}
+
+// ParseKeyFormat takes a KeyFormat name, openssh, pkcs8 or seed, and returns the KeyFormat
+func ParseKeyFormat(s string) (KeyFormat, error) {
+	for f, n := range keyFormatNames {
+		if n == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid key format: %q, must be openssh, pkcs8 or seed", s)
+}
+
+// ParsePrivateKey parses an ed25519 private key in any KeyFormat and returns it as a
+// sig.Signer. Passphrase protected OpenSSH keys are decrypted with the passphrase
+// set by WithPassphrase.
+func ParsePrivateKey(b []byte, opts ...Option) (sig.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return parseSeed(b)
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		key, err = ssh.ParseRawPrivateKey(b)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			passphrase, perr := parseOptions(opts...).readPassphrase()
+			if perr != nil {
+				return nil, perr
+			}
+			key, err = ssh.ParseRawPrivateKeyWithPassphrase(b, passphrase)
+		}
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: pem type %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return sig.NewNaClSignFromSeed(k.Seed())
+	case *ed25519.PrivateKey:
+		return sig.NewNaClSignFromSeed(k.Seed())
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
+
+// parseSeed parses a 32 byte ed25519 seed from raw bytes or hex or base64 text
+func parseSeed(b []byte) (sig.Signer, error) {
+	if len(b) == ed25519.SeedSize {
+		return sig.NewNaClSignFromSeed(b)
+	}
+	t := string(bytes.TrimSpace(b))
+	for _, decode := range []func(string) ([]byte, error){
+		hex.DecodeString,
+		base64.StdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+	} {
+		if seed, err := decode(t); err == nil && len(seed) == ed25519.SeedSize {
+			return sig.NewNaClSignFromSeed(seed)
+		}
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// MarshalPrivateKey returns the private key of an ed25519 sig.Signer in KeyFormat f.
+// OpenSSH keys are written without a passphrase or comment.
+func MarshalPrivateKey(s sig.Signer, f KeyFormat) ([]byte, error) {
+	n, ok := s.(*sig.NaClSign)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, s)
+	}
+	key := ed25519.NewKeyFromSeed(n.Seed())
+	switch f {
+	case KeyFormatOpenSSH:
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(block), nil
+	case KeyFormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	case KeyFormatSeed:
+		return n.Seed(), nil
+	}
+	return nil, fmt.Errorf("invalid key format: %v", f)
+}
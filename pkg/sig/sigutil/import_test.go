@@ -0,0 +1,164 @@
+package sigutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	t.Parallel()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openssh, err := ssh.MarshalPrivateKey(priv, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "test", []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := WithPassphrase(func() ([]byte, error) { return []byte("hunter2"), nil })
+
+	tests := []struct {
+		name string
+		key  []byte
+		opts []Option
+	}{
+		{"openssh", pem.EncodeToMemory(openssh), nil},
+		{"openssh passphrase", pem.EncodeToMemory(protected), []Option{passphrase}},
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil},
+		{"raw seed", priv.Seed(), nil},
+		{"hex seed", []byte(hex.EncodeToString(priv.Seed()) + "\n"), nil},
+		{"base64 seed", []byte(base64.StdEncoding.EncodeToString(priv.Seed())), nil},
+	}
+	for _, test := range tests {
+		s, err := ParsePrivateKey(test.key, test.opts...)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(s.(sig.Keyer).PublicKey(), pub) {
+			t.Errorf("%v: public key mismatch", test.name)
+		}
+	}
+
+	if _, err := ParsePrivateKey(pem.EncodeToMemory(protected)); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("unexpected error without passphrase: %v", err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKCS8PrivateKey(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsupported := [][]byte{
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}),
+		[]byte("not a key"),
+	}
+	for i, b := range unsupported {
+		if _, err := ParsePrivateKey(b); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("unsupported key %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestMarshalPrivateKey(t *testing.T) {
+	t.Parallel()
+
+	s := sig.GenNaclSign()
+	for _, f := range []KeyFormat{KeyFormatOpenSSH, KeyFormatPKCS8, KeyFormatSeed} {
+		b, err := MarshalPrivateKey(s, f)
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		p, err := ParsePrivateKey(b)
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		if p.(*sig.NaClSign).PrivateKey != s.PrivateKey {
+			t.Errorf("%v: private key mismatch after round trip", f)
+		}
+		if g, err := ParseKeyFormat(f.String()); err != nil || g != f {
+			t.Errorf("%v: parse key format: %v, %v", f, g, err)
+		}
+	}
+	if _, err := MarshalPrivateKey(sig.GenECDSAP256(), KeyFormatPKCS8); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestKeySetFileAdd(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "hashmap-keyset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hashmap.keyset")
+	existing := sig.GenNaclSign()
+	b, err := Encode([]sig.Signer{existing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	k, err := OpenKeySetFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	added := sig.GenNaclSign()
+	if err := k.Add(added, existing); err == nil {
+		t.Error("failed to catch duplicate key")
+	}
+	if err := k.Add(added); err != nil {
+		t.Fatal(err)
+	}
+	e, err := k.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("unexpected signer count: %d", len(signers))
+	}
+	if s, _ := SignersEndpoint([]sig.Signer{existing, added}); s != e {
+		t.Error("endpoint does not match keys in order")
+	}
+}
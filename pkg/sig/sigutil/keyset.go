@@ -0,0 +1,295 @@
+package sigutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+var (
+	// ErrKeySetLocked is returned by OpenKeySetFile when the lock file for a keyset
+	// already exists. If no other process is using the keyset, the lock file was
+	// left by a crash and can be removed by hand.
+	ErrKeySetLocked = errors.New("sigutil: keyset is locked by another process")
+	// ErrKeySetClosed is returned when signing with a KeySetFile that has been closed.
+	ErrKeySetClosed = errors.New("sigutil: keyset is closed")
+)
+
+// KeySetFile is a keyset on disk that is held open for signing. Stateful
+// signers, such as XMSS, advance their private key index on every signature. Signing
+// through a KeySetFile atomically writes the advanced state back to disk before a
+// signature Bundle is returned, so that a one-time key is never released twice. While
+// open, the keyset is guarded by a lock file to prevent concurrent use by other processes.
+type KeySetFile struct {
+	sync.Mutex
+	path    string
+	lock    string
+	closed  bool
+	legacy  bool
+	keyset  *KeySet
+	cipher  *keySetCipher
+	signers []sig.Signer
+}
+
+// OpenKeySetFile acquires the lock file for the keyset at path, decodes it and returns
+// a KeySetFile. Encrypted keysets are decrypted with the passphrase set by WithPassphrase
+// and stay encrypted when saved. Close must be called to release the lock.
+func OpenKeySetFile(path string, opts ...Option) (*KeySetFile, error) {
+	lock := path + ".lock"
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("%v: %v", ErrKeySetLocked, lock)
+		}
+		return nil, err
+	}
+	f.WriteString(strconv.Itoa(os.Getpid()))
+	f.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		os.Remove(lock)
+		return nil, err
+	}
+	ks, c, err := unmarshalKeySet(b, parseOptions(opts...))
+	if err != nil {
+		os.Remove(lock)
+		return nil, err
+	}
+	signers, err := ks.Signers()
+	if err != nil {
+		os.Remove(lock)
+		return nil, err
+	}
+	return &KeySetFile{
+		path:    path,
+		lock:    lock,
+		legacy:  IsLegacyKeySet(b),
+		keyset:  ks,
+		cipher:  c,
+		signers: signers,
+	}, nil
+}
+
+// Signers returns the keyset as a slice of sig.Signer that also implement sig.Keyer.
+// Every call to Sign on a returned signer persists the keyset and returns an error, without a Bundle, if the new state
+// can not be written to disk.
+func (k *KeySetFile) Signers() []sig.Signer {
+	s := make([]sig.Signer, len(k.signers))
+	for i, signer := range k.signers {
+		s[i] = &persistSigner{signer: signer, keyset: k}
+	}
+	return s
+}
+
+// Endpoint returns the endpoint of the keyset, derived from its public keys in order
+func (k *KeySetFile) Endpoint() (string, error) {
+	k.Lock()
+	defer k.Unlock()
+	return SignersEndpoint(k.signers)
+}
+
+// Close releases the keyset lock file. Signers returned by the KeySetFile can no
+// longer be used after Close.
+func (k *KeySetFile) Close() error {
+	k.Lock()
+	defer k.Unlock()
+	if k.closed {
+		return nil
+	}
+	k.closed = true
+	return os.Remove(k.lock)
+}
+
+// Legacy returns true if the keyset file was read in the gob format of earlier
+// versions and has not been saved since.
+func (k *KeySetFile) Legacy() bool {
+	k.Lock()
+	defer k.Unlock()
+	return k.legacy
+}
+
+// Add appends signers to the keyset, created at the current time, and saves it. Adding
+// keys changes the endpoint of the keyset. Add returns an error without changing the
+// keyset if a signer's public key is already in the keyset.
+func (k *KeySetFile) Add(signers ...sig.Signer) error {
+	k.Lock()
+	defer k.Unlock()
+	if k.closed {
+		return ErrKeySetClosed
+	}
+	added, err := NewKeySet(signers, time.Now())
+	if err != nil {
+		return err
+	}
+	keys := append(append([]Key{}, k.keyset.Keys...), added.Keys...)
+	for i := len(k.keyset.Keys); i < len(keys); i++ {
+		for _, existing := range keys[:i] {
+			if bytes.Equal(existing.PublicKey, keys[i].PublicKey) {
+				return fmt.Errorf("sigutil: %v key %x is already in the keyset", keys[i].Alg, keys[i].PublicKey)
+			}
+		}
+	}
+	prevKeys, prevSigners := k.keyset.Keys, k.signers
+	k.keyset.Keys = keys
+	k.signers = append(append([]sig.Signer{}, k.signers...), signers...)
+	if err := k.save(); err != nil {
+		k.keyset.Keys, k.signers = prevKeys, prevSigners
+		return err
+	}
+	return nil
+}
+
+// Encrypted returns true if the keyset is encrypted with a passphrase on disk.
+func (k *KeySetFile) Encrypted() bool {
+	k.Lock()
+	defer k.Unlock()
+	return k.cipher != nil
+}
+
+// SetPassphrase encrypts the keyset with a new passphrase and saves it. An empty
+// passphrase removes the encryption and saves the keyset in plaintext.
+func (k *KeySetFile) SetPassphrase(passphrase []byte) error {
+	k.Lock()
+	defer k.Unlock()
+	if k.closed {
+		return ErrKeySetClosed
+	}
+	var c *keySetCipher
+	if len(passphrase) > 0 {
+		var err error
+		if c, err = newKeySetCipher(passphrase); err != nil {
+			return err
+		}
+	}
+	prev := k.cipher
+	k.cipher = c
+	if err := k.save(); err != nil {
+		k.cipher = prev
+		return err
+	}
+	return nil
+}
+
+// Save atomically writes the keyset to disk in the current format. Signing saves the
+// keyset automatically, so Save is only needed to migrate a legacy keyset.
+func (k *KeySetFile) Save() error {
+	k.Lock()
+	defer k.Unlock()
+	if k.closed {
+		return ErrKeySetClosed
+	}
+	return k.save()
+}
+
+// save updates the keyset keys from the signers, keeping their creation times, and
+// atomically writes it to disk. Callers must hold the lock.
+func (k *KeySetFile) save() error {
+	for i, s := range k.signers {
+		if err := k.keyset.Keys[i].update(s); err != nil {
+			return err
+		}
+	}
+	var b []byte
+	var err error
+	if k.cipher != nil {
+		b, err = k.cipher.seal(k.keyset)
+	} else {
+		b, err = MarshalKeySet(k.keyset)
+	}
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(k.path, b, 0600); err != nil {
+		return err
+	}
+	k.legacy = false
+	return nil
+}
+
+// persistSigner wraps a sig.Signer and saves its KeySetFile after every signature.
+type persistSigner struct {
+	signer sig.Signer
+	keyset *KeySetFile
+}
+
+// Alg returns the Alg of the wrapped signer. Every signer in a KeySet implements sig.Keyer.
+func (p *persistSigner) Alg() sig.Alg {
+	return p.signer.(sig.Keyer).Alg()
+}
+
+// PublicKey returns the public key of the wrapped signer
+func (p *persistSigner) PublicKey() []byte {
+	return p.signer.(sig.Keyer).PublicKey()
+}
+
+// Sign signs the message with the wrapped signer and persists the keyset before the
+// Bundle is returned. The keyset is saved even if signing fails, because a stateful
+// signer may have advanced its state before failing.
+func (p *persistSigner) Sign(message []byte) (sig.Bundle, error) {
+	p.keyset.Lock()
+	defer p.keyset.Unlock()
+	if p.keyset.closed {
+		return sig.Bundle{}, ErrKeySetClosed
+	}
+	b, signErr := p.signer.Sign(message)
+	if err := p.keyset.save(); err != nil {
+		return sig.Bundle{}, fmt.Errorf("sigutil: refusing to sign, keyset state not persisted: %v", err)
+	}
+	if signErr != nil {
+		return sig.Bundle{}, signErr
+	}
+	return b, nil
+}
+
+// WriteFileAtomic writes b to a temporary file in the same directory as path, syncs it
+// to disk and renames it over path. The parent directory is synced afterwards so that
+// the rename itself is durable. A reader will see either the old or the new contents.
+func WriteFileAtomic(path string, b []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := writeSyncClose(f, b, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// writeSyncClose sets the file mode, writes b, syncs and closes f.
+func writeSyncClose(f *os.File, b []byte, perm os.FileMode) error {
+	defer f.Close()
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,129 @@
+package sigutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sig "github.com/nomasters/hashmap/pkg/sig"
+)
+
+func TestKeySetFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "hashmap-keyset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hashmap.keyset")
+	b, err := Encode(NewExperimentalSigners())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m := []byte("hello, world")
+
+	t.Run("persists state", func(t *testing.T) {
+		k, err := OpenKeySetFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenKeySetFile(path); err == nil {
+			t.Error("failed to catch locked keyset")
+		}
+		pre := k.signers[1].(*sig.XMSS10).PrivateKey
+		if _, err := SignAll(m, k.Signers()); err != nil {
+			t.Error(err)
+		}
+		if err := k.Close(); err != nil {
+			t.Error(err)
+		}
+		if _, err := SignAll(m, k.Signers()); err == nil {
+			t.Error("failed to catch sign on closed keyset")
+		}
+
+		k, err = OpenKeySetFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer k.Close()
+		post := k.signers[1].(*sig.XMSS10).PrivateKey
+		if bytes.Equal(pre[:4], post[:4]) {
+			t.Error("xmss index was not persisted")
+		}
+	})
+
+	t.Run("refuses to sign without persisting", func(t *testing.T) {
+		sub := filepath.Join(dir, "sub")
+		if err := os.Mkdir(sub, 0700); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(sub, "hashmap.keyset")
+		if err := ioutil.WriteFile(p, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		k, err := OpenKeySetFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.RemoveAll(sub); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := SignAll(m, k.Signers()); err == nil {
+			t.Error("failed to catch unpersisted state")
+		}
+	})
+
+	t.Run("migrates legacy keyset", func(t *testing.T) {
+		legacy, err := ioutil.ReadFile("../../../test/testdata/hashmap_ed25519.keyset")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, "legacy.keyset")
+		if err := ioutil.WriteFile(p, legacy, 0600); err != nil {
+			t.Fatal(err)
+		}
+		k, err := OpenKeySetFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !k.Legacy() {
+			t.Error("gob keyset not reported as legacy")
+		}
+		if err := k.Save(); err != nil {
+			t.Fatal(err)
+		}
+		if k.Legacy() {
+			t.Error("saved keyset reported as legacy")
+		}
+		if err := k.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := k.Save(); err != ErrKeySetClosed {
+			t.Errorf("unexpected error saving closed keyset: %v", err)
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsLegacyKeySet(b) {
+			t.Error("keyset was not migrated")
+		}
+	})
+
+	t.Run("missing keyset", func(t *testing.T) {
+		p := filepath.Join(dir, "missing.keyset")
+		if _, err := OpenKeySetFile(p); err == nil {
+			t.Error("failed to catch missing keyset")
+		}
+		if _, err := os.Stat(p + ".lock"); !os.IsNotExist(err) {
+			t.Error("lock file not released")
+		}
+	})
+}
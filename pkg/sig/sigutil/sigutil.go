@@ -2,18 +2,17 @@ package sigutil
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/gob"
+	"fmt"
+	"strings"
+	"time"
 
 	sig "github.com/nomasters/hashmap/pkg/sig"
 	blake2b "golang.org/x/crypto/blake2b"
 )
 
-func init() {
-	gob.Register(&sig.NaClSign{})
-	gob.Register(&sig.XMSS10{})
-}
-
 // NewDefaultSigners returns a slice of sig.Signer that
 // includes an ed25519 sig
 func NewDefaultSigners() (s []sig.Signer) {
@@ -26,20 +25,96 @@ func NewExperimentalSigners() (s []sig.Signer) {
 	return append(s, sig.GenNaclSign(), sig.GenXMSS10())
 }
 
-// Encode takes a slice of sig.Signer and returns a gob
-// encoded byte slice and an error
+// NewHybridSigners returns a slice of sig.Signer that includes
+// an ed25519 sig and a stateless post-quantum ML-DSA-65 sig
+func NewHybridSigners() (s []sig.Signer) {
+	return append(s, sig.GenNaclSign(), sig.GenMLDSA65())
+}
+
+// Presets maps the names of the keyset presets to the func that generates them
+var Presets = map[string]func() []sig.Signer{
+	"default":      NewDefaultSigners,
+	"experimental": NewExperimentalSigners,
+	"hybrid":       NewHybridSigners,
+}
+
+// typeAliases maps common key type names to registered sig algorithm names
+var typeAliases = map[string]string{
+	"ed25519":    "nacl_sign",
+	"ecdsa_p256": "ecdsa_p256_sha256",
+	"secp256k1":  "secp256k1_sha256",
+}
+
+// LookupType returns the registered sig.Algorithm for a key type, which is a registered
+// algorithm name or one of the aliases ed25519, ecdsa_p256 and secp256k1, and is case
+// insensitive.
+func LookupType(t string) (sig.Algorithm, error) {
+	name := strings.ToLower(strings.TrimSpace(t))
+	if alias, ok := typeAliases[name]; ok {
+		name = alias
+	}
+	return sig.LookupName(name)
+}
+
+// GenerateSigners returns a newly generated sig.Signer for each key type, in the order
+// given. Types are resolved with LookupType, for example nacl_sign, ed25519 or
+// xmss_sha2_10_256.
+func GenerateSigners(types []string) ([]sig.Signer, error) {
+	signers := make([]sig.Signer, len(types))
+	for i, t := range types {
+		a, err := LookupType(t)
+		if err != nil {
+			return nil, err
+		}
+		if a.Gen == nil {
+			return nil, fmt.Errorf("sigutil: %v keys can not be generated", a.Name)
+		}
+		signers[i] = a.Gen()
+	}
+	return signers, nil
+}
+
+// SignersEndpoint returns the endpoint of a slice of sig.Signer without signing. It is
+// the EncodedBundleHash of their public keys in slice order, so the same keys in a
+// different order have a different endpoint.
+func SignersEndpoint(signers []sig.Signer) (string, error) {
+	bundles := make([]sig.Bundle, len(signers))
+	for i, s := range signers {
+		k, ok := s.(sig.Keyer)
+		if !ok {
+			return "", fmt.Errorf("sigutil: %T does not implement sig.Keyer", s)
+		}
+		bundles[i] = sig.Bundle{Alg: k.Alg(), Pub: k.PublicKey()}
+	}
+	return EncodedBundleHash(bundles), nil
+}
+
+// Encode takes a slice of sig.Signer and returns a JSON encoded KeySet
+// and an error. Every signer must describe its key with sig.Keyer and
+// use an Alg registered with the sig package.
 func Encode(s []sig.Signer) ([]byte, error) {
-	var buffer bytes.Buffer
-	err := gob.NewEncoder(&buffer).Encode(s)
-	return buffer.Bytes(), err
+	ks, err := NewKeySet(s, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return MarshalKeySet(ks)
+}
+
+// Decode takes a JSON KeySet, or a gob encoded keyset written by earlier
+// versions, and returns a []sig.Signer and an error. Encrypted keysets require
+// WithPassphrase.
+func Decode(b []byte, opts ...Option) ([]sig.Signer, error) {
+	ks, err := UnmarshalKeySet(b, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ks.Signers()
 }
 
-// Decode takes a gob encoded byte slice and returns
-// a []sig.Signer and an error.
-func Decode(b []byte) (s []sig.Signer, err error) {
-	var buffer bytes.Buffer
-	buffer.Write(b)
-	err = gob.NewDecoder(&buffer).Decode(&s)
+// decodeGob takes a gob encoded byte slice and returns a []sig.Signer
+// and an error.
+func decodeGob(b []byte) (s []sig.Signer, err error) {
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&s)
 	return s, err
 }
 
@@ -47,9 +122,15 @@ func Decode(b []byte) (s []sig.Signer, err error) {
 // of signers. It takes a slice of sig.Signers and the bytes for signing and
 // returns a slice of sig.Bundles and an error
 func SignAll(message []byte, signers []sig.Signer) ([]sig.Bundle, error) {
+	return SignAllContext(context.Background(), message, signers)
+}
+
+// SignAllContext is like SignAll but signs with sig.SignContext, so that signing
+// with remote signers, such as those of a signing agent, can be canceled.
+func SignAllContext(ctx context.Context, message []byte, signers []sig.Signer) ([]sig.Bundle, error) {
 	var sigBundles []sig.Bundle
 	for _, s := range signers {
-		bundle, err := s.Sign(message)
+		bundle, err := sig.SignContext(ctx, s, message)
 		if err != nil {
 			return nil, err
 		}
@@ -69,6 +150,17 @@ func VerifyAll(message []byte, bundles []sig.Bundle) bool {
 	return true
 }
 
+// VerifyBundles takes message bytes and a slice of sig.Bundles and returns an error
+// describing the first bundle that fails sig.VerifyBundle
+func VerifyBundles(message []byte, bundles []sig.Bundle) error {
+	for i, bundle := range bundles {
+		if err := sig.VerifyBundle(message, bundle); err != nil {
+			return fmt.Errorf("bundle %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 // BundlePubKeys returns a byte slice of all pubkeys concatenated in the index
 // order of the slice of sig.Bundles.
 func BundlePubKeys(bundles []sig.Bundle) []byte {
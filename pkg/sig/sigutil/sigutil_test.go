@@ -2,6 +2,7 @@ package sigutil
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 
 	sig "github.com/nomasters/hashmap/pkg/sig"
@@ -39,6 +40,60 @@ func TestEncodeDecode(t *testing.T) {
 	}
 }
 
+func TestEncodeDecodeECDSA(t *testing.T) {
+	t.Parallel()
+
+	s := []sig.Signer{sig.GenECDSAP256(), sig.GenSecp256k1()}
+	b, err := Encode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := []byte("hello, world.")
+	for i := range s {
+		sb, _ := s[i].Sign(m)
+		ob, err := o[i].Sign(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sb.Sig, ob.Sig) {
+			t.Errorf("decode signature mismatch for %v", sb.Alg)
+		}
+	}
+}
+
+func TestPresets(t *testing.T) {
+	t.Parallel()
+
+	for name, preset := range Presets {
+		if _, err := Encode(preset()); err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+	s := NewHybridSigners()
+	if k, ok := s[1].(sig.Keyer); !ok || !k.Alg().PQR() {
+		t.Error("hybrid preset has no post-quantum signer")
+	}
+}
+
+// unregisteredSigner is a sig.Signer whose Alg is not registered
+type unregisteredSigner struct{}
+
+func (unregisteredSigner) Sign([]byte) (sig.Bundle, error) { return sig.Bundle{}, nil }
+func (unregisteredSigner) Alg() sig.Alg                    { return 0xffff }
+func (unregisteredSigner) PublicKey() []byte               { return nil }
+
+func TestEncodeUnregistered(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Encode([]sig.Signer{unregisteredSigner{}}); !errors.Is(err, sig.ErrUnknownAlg) {
+		t.Errorf("expected ErrUnknownAlg, got: %v", err)
+	}
+}
+
 func TestSignAll(t *testing.T) {
 	t.Parallel()
 	s := NewDefaultSigners()
@@ -60,3 +115,45 @@ func TestVerifyAll(t *testing.T) {
 		t.Error("VerifyAll failed for", b)
 	}
 }
+
+func TestGenerateSigners(t *testing.T) {
+	t.Parallel()
+
+	s, err := GenerateSigners([]string{"ed25519", "ECDSA_P256", "secp256k1_sha256", "ml_dsa_65"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sig.Alg{sig.AlgNaClSign, sig.AlgECDSAP256, sig.AlgSecp256k1, sig.AlgMLDSA65}
+	for i, a := range want {
+		if got := s[i].(sig.Keyer).Alg(); got != a {
+			t.Errorf("signer %d: got %v, want %v", i, got, a)
+		}
+	}
+	if _, err := GenerateSigners([]string{"ed25519", "unknown"}); !errors.Is(err, sig.ErrUnknownAlg) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSignersEndpoint(t *testing.T) {
+	t.Parallel()
+
+	s := []sig.Signer{sig.GenNaclSign(), sig.GenECDSAP256()}
+	e, err := SignersEndpoint(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundles, err := SignAll([]byte("hello, world"), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != EncodedBundleHash(bundles) {
+		t.Error("endpoint does not match signed bundles")
+	}
+	r, err := SignersEndpoint([]sig.Signer{s[1], s[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == e {
+		t.Error("reordered keys should have a different endpoint")
+	}
+}
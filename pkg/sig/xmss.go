@@ -1,26 +1,155 @@
 package sig
 
 import (
+	"encoding/binary"
 	"errors"
 	"sync"
 
 	xmss "github.com/danielhavir/go-xmss"
 )
 
+// go-xmss only implements single tree XMSS (d = 1), so XMSS^MT parameter sets
+// are not supported. Every parameter set below uses n = 32, which gives the same
+// 132 byte private key layout: index(4) | prvSeed(32) | prfSeed(32) | pubSeed(32) | root(32)
+const (
+	xmssN            = 32
+	xmssIndexBytes   = 4
+	xmssPrivKeySize  = xmssIndexBytes + 4*xmssN
+	xmssPubSeedStart = xmssIndexBytes + 2*xmssN
+	xmssRootStart    = xmssIndexBytes + 3*xmssN
+	xmssPubKeySize   = 2 * xmssN
+)
+
+// xmss10Capacity is the number of one-time keys in an XMSS tree of height 10
+const xmss10Capacity = 1 << 10
+
+// xmssParamSet describes an XMSS parameter set and the Alg it is registered as
+type xmssParamSet struct {
+	alg      Alg
+	name     string
+	params   *xmss.Params
+	capacity uint64
+}
+
+// xmssParamSets are the supported XMSS parameter sets. go-xmss recomputes the full tree
+// on key generation and on every signature, so the cost of both grows with capacity:
+// roughly a second for SHA2_10_256 and a minute for SHA2_16_256 on current hardware.
+// SHA2_20_256 would take tens of minutes per signature, so it is left out until there
+// is a signer that caches tree state.
+var (
+	xmss10 = xmssParamSet{alg: AlgXMSS10, name: "xmss_sha2_10_256", params: xmss.SHA2_10_256, capacity: xmss10Capacity}
+	xmss16 = xmssParamSet{alg: AlgXMSS16, name: "xmss_sha2_16_256", params: xmss.SHA2_16_256, capacity: 1 << 16}
+)
+
+func init() {
+	registerXMSS(xmss10, GenXMSS10, NewXMSS10)
+	registerXMSS(xmss16, GenXMSS16, NewXMSS16)
+}
+
+// xmssSigner is implemented by the XMSS Signer types
+type xmssSigner interface {
+	Signer
+	privateKey() []byte
+}
+
+// registerXMSS registers the Algorithm for an XMSS parameter set and its Signer type
+func registerXMSS[T xmssSigner](set xmssParamSet, gen func() T, newKey func([]byte) T) {
+	marshal, unmarshal := keyCodec(set.name, xmssPrivKeySize, func(s T) []byte { return s.privateKey() }, newKey)
+	MustRegister(Algorithm{
+		Alg:          set.alg,
+		Name:         set.name,
+		PubKeySize:   xmssPubKeySize,
+		SigSize:      set.params.SignBytes(),
+		PQR:          true,
+		Verify:       set.verify,
+		Key:          newKey(nil),
+		Gen:          func() Signer { return gen() },
+		MarshalKey:   marshal,
+		UnmarshalKey: unmarshal,
+	})
+}
+
+// generate returns a new random private key for the parameter set
+func (p xmssParamSet) generate() [xmssPrivKeySize]byte {
+	var pk [xmssPrivKeySize]byte
+	k, _ := xmss.GenerateXMSSKeypair(p.params)
+	copy(pk[:], *k)
+	return pk
+}
+
+// xmssPublicKey returns the 64 byte XMSS public key root|pubSeed of a private key
+func xmssPublicKey(prv *[xmssPrivKeySize]byte) []byte {
+	pub := make([]byte, xmssPubKeySize)
+	copy(pub[:xmssN], prv[xmssRootStart:xmssRootStart+xmssN])
+	copy(pub[xmssN:], prv[xmssPubSeedStart:xmssPubSeedStart+xmssN])
+	return pub
+}
+
+// remaining reads the big endian leaf index from a private key and returns the
+// number of unused one-time keys
+func (p xmssParamSet) remaining(prv *[xmssPrivKeySize]byte) uint64 {
+	idx := uint64(binary.BigEndian.Uint32(prv[:xmssIndexBytes]))
+	if idx >= p.capacity {
+		return 0
+	}
+	return p.capacity - idx
+}
+
+// sign signs a message with a private key, advancing its index while m is held. It
+// returns an *ExhaustedError once all one-time keys have been used.
+func (p xmssParamSet) sign(m *sync.RWMutex, prv *[xmssPrivKeySize]byte, message []byte) (Bundle, error) {
+	m.Lock()
+	if p.remaining(prv) == 0 {
+		m.Unlock()
+		return Bundle{}, &ExhaustedError{Alg: p.alg, Capacity: p.capacity}
+	}
+	k := xmss.PrivateXMSS(prv[:])
+	pub := xmssPublicKey(prv)
+	sig := *k.Sign(p.params, message)
+	copy(prv[:], k)
+	m.Unlock()
+
+	b := Bundle{
+		Alg: p.alg,
+		Pub: pub,
+		Sig: Bytes(sig[:p.params.SignBytes()]),
+	}
+
+	if ok := p.verify(message, b); !ok {
+		return Bundle{}, errors.New("verification sanity check failed on sign")
+	}
+
+	return b, nil
+}
+
+// verify returns true if the Bundle is a valid signature of msg for the parameter set
+func (p xmssParamSet) verify(msg []byte, b Bundle) bool {
+	n := p.params.SignBytes()
+	if len(b.Sig) != n || len(b.Pub) != xmssPubKeySize {
+		return false
+	}
+	sig := make([]byte, 0, n+len(msg))
+	sig = append(append(sig, b.Sig...), msg...)
+	m := make([]byte, n+len(msg))
+	return xmss.Verify(p.params, m, sig, []byte(b.Pub))
+}
+
 // XMSS10 holds a pointer to a 132 byte array used by XMSS. It implements the
-// Signer interface.
+// Signer interface. Unlike the other XMSS types it does not embed xmssKey, because
+// keysets encoded with gob by earlier versions decode into its PrivateKey.
 type XMSS10 struct {
-	m          sync.RWMutex
+	m sync.RWMutex
+	// Deprecated: PrivateKey is only exported so that keysets encoded with gob by
+	// earlier versions can be decoded. Use MarshalKey to read the private key.
 	PrivateKey [132]byte
 }
 
-// GenXMSS10 returns a randomly generated XMSS SHA2_10_256 private key in a NaClSign
+// GenXMSS10 returns a randomly generated XMSS SHA2_10_256 private key in an XMSS10
 func GenXMSS10() *XMSS10 {
-	k, _ := xmss.GenerateXMSSKeypair(xmss.SHA2_10_256)
-	return NewXMSS10((*k)[:])
+	return &XMSS10{PrivateKey: xmss10.generate()}
 }
 
-// NewXMSS10 takes an XMSS private key as a byte array and returns a NaClSign
+// NewXMSS10 takes an XMSS private key as a byte array and returns an XMSS10
 func NewXMSS10(privateKey []byte) *XMSS10 {
 	var pk [132]byte
 	copy(pk[:], privateKey)
@@ -29,37 +158,116 @@ func NewXMSS10(privateKey []byte) *XMSS10 {
 	}
 }
 
-// Sign takes a message and returns a Bundle signed with a private key using XMSS SHA2_10_256.
-func (s *XMSS10) Sign(message []byte) (Bundle, error) {
-	s.m.Lock()
-	prv := xmss.PrivateXMSS(s.PrivateKey[:])
-	pub := make([]byte, 64)
-	copy(pub[:32], prv[100:])
-	copy(pub[32:], prv[68:100])
+// Alg returns AlgXMSS10
+func (s *XMSS10) Alg() Alg {
+	return AlgXMSS10
+}
 
-	prm := xmss.SHA2_10_256
-	sig := *prv.Sign(prm, message)
-	copy(s.PrivateKey[:], prv)
-	s.m.Unlock()
+// PublicKey returns the 64 byte XMSS public key as root|pubSeed.
+func (s *XMSS10) PublicKey() []byte {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return xmssPublicKey(&s.PrivateKey)
+}
 
-	b := Bundle{
-		Alg: AlgXMSS10,
-		Pub: pub,
-		Sig: Bytes(sig[:prm.SignBytes()]),
-	}
+// privateKey returns a copy of the private key, including the leaf index
+func (s *XMSS10) privateKey() []byte {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return append([]byte{}, s.PrivateKey[:]...)
+}
 
-	if ok := VerifyXMSS10(message, b); !ok {
-		return Bundle{}, errors.New("verification sanity check failed on sign")
-	}
+// Capacity returns the total number of signatures an XMSS10 key can produce.
+func (s *XMSS10) Capacity() uint64 {
+	return xmss10.capacity
+}
 
-	return b, nil
+// Remaining returns the number of unused one-time keys left in the tree.
+func (s *XMSS10) Remaining() uint64 {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return xmss10.remaining(&s.PrivateKey)
+}
+
+// Sign takes a message and returns a Bundle signed with a private key using XMSS SHA2_10_256.
+// It returns an *ExhaustedError once all one-time keys in the tree have been used.
+func (s *XMSS10) Sign(message []byte) (Bundle, error) {
+	return xmss10.sign(&s.m, &s.PrivateKey, message)
 }
 
 // VerifyXMSS10 takes a message and a Bundle and bool indicating if the message
-// is verified ny the signature.
+// is verified by the signature.
 func VerifyXMSS10(msg []byte, b Bundle) bool {
-	prm := xmss.SHA2_10_256
-	sig := append(b.Sig, msg...)
-	m := make([]byte, prm.SignBytes()+len(msg))
-	return xmss.Verify(prm, m, sig, []byte(b.Pub))
+	return xmss10.verify(msg, b)
+}
+
+// xmssKey is a 132 byte private key of an XMSS parameter set. It implements the
+// Signer, Keyer and Stateful methods of the XMSS types.
+type xmssKey struct {
+	set *xmssParamSet
+	m   sync.RWMutex
+	prv [xmssPrivKeySize]byte
+}
+
+// Alg returns the Alg of the parameter set
+func (k *xmssKey) Alg() Alg {
+	return k.set.alg
+}
+
+// PublicKey returns the 64 byte XMSS public key as root|pubSeed.
+func (k *xmssKey) PublicKey() []byte {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	return xmssPublicKey(&k.prv)
+}
+
+// privateKey returns a copy of the private key, including the leaf index
+func (k *xmssKey) privateKey() []byte {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	return append([]byte{}, k.prv[:]...)
+}
+
+// Capacity returns the total number of signatures the key can produce.
+func (k *xmssKey) Capacity() uint64 {
+	return k.set.capacity
+}
+
+// Remaining returns the number of unused one-time keys left in the tree.
+func (k *xmssKey) Remaining() uint64 {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	return k.set.remaining(&k.prv)
+}
+
+// Sign takes a message and returns a Bundle signed with the private key. It returns
+// an *ExhaustedError once all one-time keys in the tree have been used.
+func (k *xmssKey) Sign(message []byte) (Bundle, error) {
+	return k.set.sign(&k.m, &k.prv, message)
+}
+
+// XMSS16 holds a 132 byte XMSS SHA2_16_256 private key with 65536 one-time keys.
+// It implements the Signer interface.
+type XMSS16 struct {
+	xmssKey
+}
+
+// GenXMSS16 returns a randomly generated XMSS SHA2_16_256 private key in an XMSS16.
+// Generation computes the full tree and takes around a minute.
+func GenXMSS16() *XMSS16 {
+	pk := xmss16.generate()
+	return NewXMSS16(pk[:])
+}
+
+// NewXMSS16 takes an XMSS SHA2_16_256 private key as a byte array and returns an XMSS16
+func NewXMSS16(privateKey []byte) *XMSS16 {
+	s := &XMSS16{xmssKey{set: &xmss16}}
+	copy(s.prv[:], privateKey)
+	return s
+}
+
+// VerifyXMSS16 takes a message and a Bundle and bool indicating if the message
+// is verified by the signature.
+func VerifyXMSS16(msg []byte, b Bundle) bool {
+	return xmss16.verify(msg, b)
 }
@@ -2,6 +2,8 @@ package sig
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"testing"
 )
 
@@ -30,3 +32,112 @@ func TestXMSS10(t *testing.T) {
 		}
 	})
 }
+
+func TestXMSS10Exhausted(t *testing.T) {
+	t.Parallel()
+	s := GenXMSS10()
+	if s.Remaining() != s.Capacity() {
+		t.Errorf("remaining: %v, expected: %v", s.Remaining(), s.Capacity())
+	}
+	binary.BigEndian.PutUint32(s.PrivateKey[:4], xmss10Capacity-1)
+	if _, err := s.Sign([]byte("last one")); err != nil {
+		t.Error(err)
+	}
+	if s.Remaining() != 0 {
+		t.Errorf("remaining: %v, expected: 0", s.Remaining())
+	}
+	_, err := s.Sign([]byte("one too many"))
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Errorf("expected ExhaustedError, got: %v", err)
+	}
+}
+
+func TestXMSSPublicKey(t *testing.T) {
+	t.Parallel()
+
+	var prv [xmssPrivKeySize]byte
+	for i := range prv {
+		prv[i] = byte(i)
+	}
+	pub := xmssPublicKey(&prv)
+	if !bytes.Equal(pub[:32], prv[100:132]) || !bytes.Equal(pub[32:], prv[68:100]) {
+		t.Errorf("public key is not root|pubSeed: %x", pub)
+	}
+	s := GenXMSS10()
+	b, err := s.Sign([]byte("sign me, plz."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Pub, s.PublicKey()) {
+		t.Error("signed public key mismatch")
+	}
+}
+
+func TestXMSSParamSets(t *testing.T) {
+	t.Parallel()
+
+	type xmssSigner interface {
+		Signer
+		Keyer
+		Stateful
+	}
+	tests := []struct {
+		newSigner func([]byte) xmssSigner
+		alg       Alg
+		name      string
+		capacity  uint64
+		sigSize   int
+	}{
+		{func(k []byte) xmssSigner { return NewXMSS10(k) }, AlgXMSS10, "xmss_sha2_10_256", 1 << 10, 2500},
+		{func(k []byte) xmssSigner { return NewXMSS16(k) }, AlgXMSS16, "xmss_sha2_16_256", 1 << 16, 2692},
+	}
+	for _, test := range tests {
+		a, err := Lookup(test.alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Name != test.name || !a.PQR || a.PubKeySize != 64 || a.SigSize != test.sigSize {
+			t.Errorf("unexpected algorithm: %+v", a)
+		}
+		s := test.newSigner(nil)
+		if s.Alg() != test.alg || s.Capacity() != test.capacity || s.Remaining() != test.capacity {
+			t.Errorf("%v: unexpected alg, capacity or remaining", test.name)
+		}
+
+		// an exhausted key is rejected before the tree is computed
+		k := make([]byte, xmssPrivKeySize)
+		binary.BigEndian.PutUint32(k, uint32(test.capacity))
+		_, err = test.newSigner(k).Sign([]byte("m"))
+		var exhausted *ExhaustedError
+		if !errors.As(err, &exhausted) || exhausted.Alg != test.alg || exhausted.Capacity != test.capacity {
+			t.Errorf("%v: expected ExhaustedError, got: %v", test.name, err)
+		}
+	}
+}
+
+func TestXMSS16(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generating and signing with an XMSS SHA2_16_256 key takes minutes")
+	}
+	t.Parallel()
+
+	m := []byte("sign me, plz.")
+	s := GenXMSS16()
+	b, err := s.Sign(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Alg != AlgXMSS16 || len(b.Sig) != 2692 || !bytes.Equal(b.Pub, s.PublicKey()) {
+		t.Errorf("unexpected bundle: alg %v, %d byte signature", b.Alg, len(b.Sig))
+	}
+	if err := VerifyBundle(m, b); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyBundle([]byte("other"), b); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("verified the wrong message: %v", err)
+	}
+	if s.Remaining() != s.Capacity()-1 {
+		t.Errorf("remaining: %v, expected: %v", s.Remaining(), s.Capacity()-1)
+	}
+}
@@ -18,20 +18,24 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	pb, err := payload.Marshal(p)
+	pb, err := payload.MarshalProto(p)
 	if err != nil {
 		log.Fatal(err)
 	}
 	baseURL := "http://localhost:3000"
-	contentType := "application/protobuf"
-	resp, err := http.Post(baseURL, contentType, bytes.NewReader(pb))
+	resp, err := http.Post(baseURL, payload.ContentTypeProtobuf, bytes.NewReader(pb))
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println(resp)
 	fmt.Println("successful post for:   ", p.Endpoint())
 
-	resp2, err := http.Get(fmt.Sprintf("%v/%v", baseURL, p.Endpoint()))
+	req, err := http.NewRequest("GET", fmt.Sprintf("%v/%v", baseURL, p.Endpoint()), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("Accept", payload.ContentTypeProtobuf)
+	resp2, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -39,7 +43,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	pResp, err := payload.Unmarshal(pbResp)
+	pResp, err := payload.UnmarshalProto(pbResp)
 	if err != nil {
 		log.Fatal(err)
 	}